@@ -14,11 +14,14 @@ import (
 	versioncollector "github.com/prometheus/client_golang/prometheus/collectors/version"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/config"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/direkt"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
 )
 
 func init() {
 	prometheus.MustRegister(versioncollector.NewCollector("direkt_exporter"))
+	prometheus.MustRegister(metrics.DroppedSeries)
 }
 
 func main() {
@@ -26,9 +29,20 @@ func main() {
 	signal.Notify(exit, os.Interrupt)
 
 	var dev bool
+	var schema string
+	var legacyNames bool
+	var limits metrics.Limits
+	var configFile string
+	var analyseThumbnails bool
 	flag.BoolVar(&dev, "development", false, "Whether to enable development mode")
 	flag.BoolVar(&dev, "dev", false, "Whether to enable development mode")
 	flag.BoolVar(&dev, "d", false, "Whether to enable development mode")
+	flag.StringVar(&schema, "metric-schema", string(direkt.SchemaV1), "Layout of the video status metrics, v1 (properties as labels) or v2 (separate info metrics)")
+	flag.BoolVar(&legacyNames, "legacy-metric-names", false, "Export metrics under their names from before the direkt_ namespace was introduced")
+	flag.IntVar(&limits.MaxSeries, "max-series-per-metric", 500, "Maximum number of series exported per metric and unit, 0 disables the limit")
+	flag.IntVar(&limits.MaxLabelLength, "max-label-length", 128, "Maximum length of label values taken from the unit, 0 disables truncation")
+	flag.StringVar(&configFile, "config", "", "Path to an optional YAML configuration file")
+	flag.BoolVar(&analyseThumbnails, "analyse-thumbnails", false, "Detect black and frozen thumbnails of polled units")
 	flag.Parse()
 
 	baseLogger := zerolog.New(os.Stderr)
@@ -47,13 +61,54 @@ func main() {
 	if username == "" || password == "" {
 		logger.Info().Str("username", username).Msg("Username or password not set, authentication will not be used")
 	}
-	d := direkt.New(username, password)
+	metricSchema, err := direkt.ParseSchema(schema)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Invalid metric schema")
+	}
+	var cfg config.Config
+	if configFile != "" {
+		cfg, err = config.Load(configFile)
+		if err != nil {
+			logger.Fatal().Err(err).Str("path", configFile).Msg("Error loading config file")
+		}
+	}
+
+	opts := direkt.Options{
+		Schema:            metricSchema,
+		LegacyNames:       legacyNames,
+		Limits:            limits,
+		Labels:            cfg.Labels,
+		ExtraLabels:       cfg.ExtraLabels,
+		AnalyseThumbnails: analyseThumbnails,
+		CustomMetrics:     cfg.CustomMetrics,
+	}
+	if err := opts.Validate(); err != nil {
+		logger.Fatal().Err(err).Msg("Invalid label configuration")
+	}
+	d := direkt.New(username, password, opts)
+
+	if len(cfg.Polling.Serials) > 0 {
+		interval := cfg.Polling.Interval
+		if interval <= 0 {
+			interval = time.Minute
+		}
+		for _, serial := range cfg.Polling.Serials {
+			if err := direkt.ValidateSerial(serial); err != nil {
+				logger.Fatal().Err(err).Str("serial", serial).Msg("Invalid serial in polling config")
+			}
+		}
+		logger.Info().Strs("serials", cfg.Polling.Serials).Dur("interval", interval).Msg("Polling units in the background")
+		go d.Poll(ctx, logger.With().Str("endpoint", "poll").Logger(), cfg.Polling.Serials, interval)
+	}
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 	})
-	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/metrics", promhttp.InstrumentMetricHandler(
+		prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+	))
 	mux.HandleFunc("/-/healthy", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Healthy"))
@@ -61,6 +116,9 @@ func main() {
 	mux.HandleFunc("/probe", func(w http.ResponseWriter, r *http.Request) {
 		d.Handle(w, r, logger.With().Str("endpoint", "probe").Logger())
 	})
+	mux.HandleFunc("/thumbnail", func(w http.ResponseWriter, r *http.Request) {
+		d.HandleThumbnail(w, r, logger.With().Str("endpoint", "thumbnail").Logger())
+	})
 
 	httpServer := &http.Server{
 		Addr:        ":9110",
@@ -74,7 +132,7 @@ func main() {
 		httpServer.Shutdown(context.Background())
 	}()
 
-	err := httpServer.ListenAndServe()
+	err = httpServer.ListenAndServe()
 	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logger.Err(err).Msg("Handler exited with error")
 	}
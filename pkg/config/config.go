@@ -0,0 +1,39 @@
+package config
+
+import (
+	"os"
+	"time"
+
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/direkt"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+	"go.yaml.in/yaml/v2"
+)
+
+// Config is the optional exporter configuration file
+type Config struct {
+	// ExtraLabels are static labels added to every metric, e.g. site or customer
+	ExtraLabels map[string]string `yaml:"extra_labels"`
+	// Labels rewrites the labels of a metric family, keyed by family name
+	Labels map[string]metrics.LabelConfig `yaml:"labels"`
+	// Polling lists units that are polled in the background instead of on every probe
+	Polling Polling `yaml:"polling"`
+	// CustomMetrics exports fields of ISS endpoints the exporter doesn't collect itself
+	CustomMetrics []direkt.CustomMetric `yaml:"custom_metrics"`
+}
+
+// Polling configures background polling of units
+type Polling struct {
+	Interval time.Duration `yaml:"interval"`
+	Serials  []string      `yaml:"serials"`
+}
+
+// Load reads and parses the configuration file at path
+func Load(path string) (Config, error) {
+	var cfg Config
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	err = yaml.UnmarshalStrict(b, &cfg)
+	return cfg, err
+}
@@ -0,0 +1,218 @@
+package direkt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	ThumbnailBlack  = "thumbnail_black"
+	ThumbnailFrozen = "thumbnail_frozen"
+)
+
+// Thumbnail labels, the kind and index are those of the /thumbnail endpoint
+const (
+	LabelThumbnailKind  = "kind"
+	LabelThumbnailIndex = "index"
+	LabelThumbnailName  = "name"
+)
+
+var thumbnailMetrics = []metrics.Gauge{
+	{
+		Name:   ThumbnailBlack,
+		Desc:   "1 if the thumbnail of the encoder or video output is black, 0 otherwise",
+		Labels: []string{LabelThumbnailKind, LabelThumbnailIndex, LabelThumbnailName},
+	},
+	{
+		Name:   ThumbnailFrozen,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "Time in seconds the thumbnail of the encoder or video output has not changed, 0 if it changed since the previous poll",
+		Labels: []string{LabelThumbnailKind, LabelThumbnailIndex, LabelThumbnailName},
+	},
+}
+
+const (
+	// blackLuma is the mean luma (0-1) below which a thumbnail is considered black
+	blackLuma = 0.1
+	// frozenDifference is the mean luma difference (0-1) to the previous thumbnail below which
+	// the picture is considered unchanged, which tolerates compression noise
+	frozenDifference = 0.01
+)
+
+// Thumbnails are reduced to a grid of luma samples before they are compared
+const (
+	lumaGridWidth  = 64
+	lumaGridHeight = 36
+)
+
+// Thumbnails are fetched in parallel with their own timeout, so they don't eat into the time
+// left for the status requests of the poll
+const (
+	thumbnailConcurrency = 4
+	thumbnailTimeout     = 10 * time.Second
+)
+
+// thumbnailSource is a thumbnail reported by a collector during a poll
+type thumbnailSource struct {
+	kind  string
+	index string
+	name  string
+	path  string
+}
+
+// key identifies the history of a thumbnail across polls
+func (s thumbnailSource) key() string {
+	return s.kind + "/" + s.index
+}
+
+// thumbnailHistory is the picture a thumbnail last changed to and when
+type thumbnailHistory struct {
+	luma    lumaGrid
+	changed time.Time
+}
+
+// addThumbnail records a thumbnail to analyse at the end of the poll. It does nothing when the
+// unit isn't polled, as frozen pictures can only be detected across polls.
+func (s *unitState) addThumbnail(kind, index, name, path string) {
+	if s == nil || path == "" {
+		return
+	}
+	s.thumbnailSources = append(s.thumbnailSources, thumbnailSource{kind: kind, index: index, name: name, path: path})
+}
+
+// observeThumbnail compares a thumbnail with the picture it last changed to and returns for how
+// long it hasn't changed
+func (s *unitState) observeThumbnail(key string, luma lumaGrid, t time.Time) time.Duration {
+	prev, ok := s.thumbnails[key]
+	if !ok || prev.luma.difference(luma) > frozenDifference {
+		s.thumbnails[key] = thumbnailHistory{luma: luma, changed: t}
+		return 0
+	}
+	return t.Sub(prev.changed)
+}
+
+// pruneThumbnails forgets the thumbnails that were not reported during the current poll, so
+// encoders and outputs that come back start with a fresh history
+func (s *unitState) pruneThumbnails() {
+	keys := make(map[string]struct{}, len(s.thumbnailSources))
+	for _, source := range s.thumbnailSources {
+		keys[source.key()] = struct{}{}
+	}
+	for key := range s.thumbnails {
+		if _, ok := keys[key]; !ok {
+			delete(s.thumbnails, key)
+		}
+	}
+}
+
+// analyseThumbnails fetches the thumbnails recorded by the other collectors of a poll and exports
+// whether they are black or frozen. It runs last and only for polled units.
+func analyseThumbnails(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	if !opts.AnalyseThumbnails || opts.state == nil {
+		return nil
+	}
+
+	mtrcs := metrics.NewGaugeMap(thumbnailMetrics, opts.metricOptions(FamilyThumbnail))
+	for _, metric := range mtrcs {
+		registry.MustRegister(metric)
+		metric.Reset()
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), thumbnailTimeout)
+	defer cancel()
+
+	sources := opts.state.thumbnailSources
+	lumas := make([]lumaGrid, len(sources))
+	var g errgroup.Group
+	g.SetLimit(thumbnailConcurrency)
+	for i, source := range sources {
+		g.Go(func() error {
+			res, err := unit.GetThumbnail(ctx, source.path)
+			if err != nil {
+				l.Err(err).Str("kind", source.kind).Str("index", source.index).Msg("Error getting thumbnail, skipping")
+				return nil
+			}
+			luma, err := decodeLuma(res)
+			if err != nil {
+				l.Err(err).Str("kind", source.kind).Str("index", source.index).Msg("Error decoding thumbnail, skipping")
+				return nil
+			}
+			lumas[i] = luma
+			return nil
+		})
+	}
+	g.Wait()
+
+	now := time.Now()
+	for i, source := range sources {
+		luma := lumas[i]
+		if luma == nil {
+			continue
+		}
+		frozen := opts.state.observeThumbnail(source.key(), luma, now)
+		mtrcs[ThumbnailBlack].WithLabelValues(source.kind, source.index, source.name).Set(metrics.BoolToFloat64(luma.mean() < blackLuma))
+		mtrcs[ThumbnailFrozen].WithLabelValues(source.kind, source.index, source.name).Set(frozen.Seconds())
+	}
+	opts.state.pruneThumbnails()
+
+	return nil
+}
+
+// lumaGrid holds luma samples (0-1) taken on an evenly spaced grid over a picture
+type lumaGrid []float64
+
+// decodeLuma decodes a JPEG or PNG thumbnail into a luma grid
+func decodeLuma(b []byte) (lumaGrid, error) {
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	if bounds.Empty() {
+		return nil, errors.New("empty thumbnail")
+	}
+
+	grid := make(lumaGrid, 0, lumaGridWidth*lumaGridHeight)
+	for y := 0; y < lumaGridHeight; y++ {
+		py := bounds.Min.Y + (2*y+1)*bounds.Dy()/(2*lumaGridHeight)
+		for x := 0; x < lumaGridWidth; x++ {
+			px := bounds.Min.X + (2*x+1)*bounds.Dx()/(2*lumaGridWidth)
+			gray := color.GrayModel.Convert(img.At(px, py)).(color.Gray)
+			grid = append(grid, float64(gray.Y)/255)
+		}
+	}
+	return grid, nil
+}
+
+func (g lumaGrid) mean() float64 {
+	var sum float64
+	for _, v := range g {
+		sum += v
+	}
+	return sum / float64(len(g))
+}
+
+// difference returns the mean absolute difference between two grids
+func (g lumaGrid) difference(o lumaGrid) float64 {
+	if len(g) != len(o) {
+		return 1
+	}
+	var sum float64
+	for i := range g {
+		sum += math.Abs(g[i] - o[i])
+	}
+	return sum / float64(len(g))
+}
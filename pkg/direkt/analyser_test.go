@@ -0,0 +1,115 @@
+package direkt
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+// encodePNG returns a PNG of the given size filled with a gray level
+func encodePNG(t *testing.T, width, height int, y uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = y
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeLuma(t *testing.T) {
+	for _, y := range []uint8{0, 16, 128, 255} {
+		luma, err := decodeLuma(encodePNG(t, 160, 90, y))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(luma) != lumaGridWidth*lumaGridHeight {
+			t.Fatalf("got %d samples, want %d", len(luma), lumaGridWidth*lumaGridHeight)
+		}
+		if want := float64(y) / 255; math.Abs(luma.mean()-want) > 1e-9 {
+			t.Errorf("mean luma of gray %d = %v, want %v", y, luma.mean(), want)
+		}
+	}
+
+	// Thumbnails smaller than the grid are sampled repeatedly
+	if _, err := decodeLuma(encodePNG(t, 4, 4, 255)); err != nil {
+		t.Errorf("small thumbnail: %v", err)
+	}
+	if _, err := decodeLuma([]byte("not an image")); err == nil {
+		t.Error("decoding garbage returned no error")
+	}
+}
+
+func TestLumaGridDifference(t *testing.T) {
+	black := lumaGrid{0, 0, 0, 0}
+	gray := lumaGrid{0.5, 0.5, 0.5, 0.5}
+	noise := lumaGrid{0.5, 0.51, 0.49, 0.5}
+
+	if got := black.difference(black); got != 0 {
+		t.Errorf("difference to itself = %v", got)
+	}
+	if got := black.difference(gray); got != 0.5 {
+		t.Errorf("black to gray = %v, want 0.5", got)
+	}
+	if got := gray.difference(noise); got > frozenDifference {
+		t.Errorf("compression noise difference %v above %v", got, frozenDifference)
+	}
+	if got := black.difference(lumaGrid{0}); got != 1 {
+		t.Errorf("difference of different sizes = %v, want 1", got)
+	}
+	if black.mean() >= blackLuma || gray.mean() < blackLuma {
+		t.Errorf("black threshold %v doesn't tell %v from %v", blackLuma, black.mean(), gray.mean())
+	}
+}
+
+func TestObserveThumbnail(t *testing.T) {
+	s := newUnitState(Options{}, time.Minute)
+	t0 := time.Unix(1700000000, 0)
+	black := lumaGrid{0, 0}
+	gray := lumaGrid{0.5, 0.5}
+
+	steps := []struct {
+		luma lumaGrid
+		want time.Duration
+	}{
+		{black, 0},
+		{black, time.Minute},
+		{lumaGrid{0.005, 0}, 2 * time.Minute},
+		{gray, 0},
+		{gray, time.Minute},
+	}
+	for i, step := range steps {
+		if got := s.observeThumbnail("encoder/0", step.luma, t0.Add(time.Duration(i)*time.Minute)); got != step.want {
+			t.Errorf("poll %d: frozen for %v, want %v", i, got, step.want)
+		}
+	}
+}
+
+func TestPruneThumbnails(t *testing.T) {
+	s := newUnitState(Options{}, time.Minute)
+	t0 := time.Unix(1700000000, 0)
+	s.observeThumbnail("encoder/0", lumaGrid{0}, t0)
+	s.observeThumbnail("encoder/1", lumaGrid{0}, t0)
+	s.observeThumbnail("video_output/0", lumaGrid{0}, t0)
+
+	s.addThumbnail(ThumbnailEncoder, "0", "Enc A", "/thumbnail.jpg")
+	s.addThumbnail(ThumbnailVideoOutput, "0", "Out A", "/thumbnail.jpg")
+	s.pruneThumbnails()
+
+	if _, ok := s.thumbnails["encoder/1"]; ok {
+		t.Error("history of an encoder missing from the poll was kept")
+	}
+	if len(s.thumbnails) != 2 {
+		t.Errorf("kept %d thumbnails, want 2", len(s.thumbnails))
+	}
+	// An encoder that comes back starts again as changed
+	if got := s.observeThumbnail("encoder/1", lumaGrid{0}, t0.Add(time.Minute)); got != 0 {
+		t.Errorf("returning encoder frozen for %v, want 0", got)
+	}
+}
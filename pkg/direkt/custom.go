@@ -0,0 +1,429 @@
+package direkt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+)
+
+// Types of custom metrics
+const (
+	CustomGauge   = "gauge"
+	CustomCounter = "counter"
+)
+
+const (
+	CustomMetricSuccess = "custom_metric_success"
+
+	// LabelCustomMetric is the name of the custom metric a success gauge is about
+	LabelCustomMetric = "metric"
+	// LabelCustomIndex is the index of the resource a templated path was expanded for
+	LabelCustomIndex = "index"
+)
+
+// customIndex is the placeholder of a path replaced by the index of every resource of the list
+// the path starts with, e.g. encoders/{index}/status
+const customIndex = "{index}"
+
+// customLists are the lists whose indexes can be used in paths
+var customLists = []string{"encoders", "network_inputs", "video_outputs"}
+
+// customNameRE matches metric names and units that don't need quoting in the text format
+var customNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// CustomMetric exports fields of an ISS endpoint the exporter doesn't collect itself
+type CustomMetric struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Unit string `yaml:"unit"`
+	// Type is gauge (default) or counter
+	Type string `yaml:"type"`
+	// Path is the endpoint relative to the unit, e.g. system/status. Paths starting with a list
+	// like encoders/{index}/status are read for every resource of the list.
+	Path string `yaml:"path"`
+	// Selector picks the elements to export from the response, e.g. remote_management.bonding.paths[*].
+	// The whole response is used when empty.
+	Selector string `yaml:"selector"`
+	// Value is the field of each element holding the value, the element itself when empty
+	Value string `yaml:"value"`
+	// Labels maps label names to fields of the element
+	Labels map[string]string `yaml:"labels"`
+}
+
+// list returns the list whose indexes the path is expanded with, or "" if it isn't templated
+func (c CustomMetric) list() string {
+	if !strings.Contains(c.Path, customIndex) {
+		return ""
+	}
+	list, _, _ := strings.Cut(c.Path, "/")
+	return list
+}
+
+// labelNames returns the label names of the metric in a stable order
+func (c CustomMetric) labelNames() []string {
+	names := make([]string, 0, len(c.Labels)+1)
+	for name := range c.Labels {
+		names = append(names, name)
+	}
+	if c.list() != "" {
+		names = append(names, LabelCustomIndex)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func (c CustomMetric) validate() error {
+	if c.Name == "" {
+		return errors.New("custom metric without name")
+	}
+	if !customNameRE.MatchString(c.Name) || (c.Unit != "" && !customNameRE.MatchString(c.Unit)) {
+		return fmt.Errorf("custom metric %s: name and unit may only contain letters, digits and underscores", c.Name)
+	}
+	if c.Name == CustomMetricSuccess {
+		return fmt.Errorf("custom metric %s: name is used by the exporter", c.Name)
+	}
+	if c.Type != "" && c.Type != CustomGauge && c.Type != CustomCounter {
+		return fmt.Errorf("custom metric %s: unknown type %q", c.Name, c.Type)
+	}
+	if c.Path == "" || strings.HasPrefix(c.Path, "/") || strings.Contains(c.Path, "..") || strings.ContainsAny(c.Path, "?#") {
+		return fmt.Errorf("custom metric %s: path must be relative to the unit, e.g. system/status", c.Name)
+	}
+	if list := c.list(); list != "" {
+		if !slices.Contains(customLists, list) || strings.Count(c.Path, customIndex) > 1 {
+			return fmt.Errorf("custom metric %s: %s can only be used once in paths starting with %s", c.Name, customIndex, strings.Join(customLists, ", "))
+		}
+		if _, ok := c.Labels[LabelCustomIndex]; ok {
+			return fmt.Errorf("custom metric %s: label %q is set from the path", c.Name, LabelCustomIndex)
+		}
+	}
+	if strings.ContainsAny(strings.ReplaceAll(c.Path, customIndex, ""), "{}") {
+		return fmt.Errorf("custom metric %s: unknown placeholder in path, only %s is supported", c.Name, customIndex)
+	}
+	for _, s := range []string{c.Selector, c.Value} {
+		if _, err := parseSelector(s); err != nil {
+			return fmt.Errorf("custom metric %s: %w", c.Name, err)
+		}
+	}
+	for _, s := range c.Labels {
+		if _, err := parseSelector(s); err != nil {
+			return fmt.Errorf("custom metric %s: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// help returns the help text of the metric, which defaults to the endpoint it is read from
+func (c CustomMetric) help() string {
+	if c.Help != "" {
+		return c.Help
+	}
+	return "Custom metric read from " + c.Path
+}
+
+// customGauges returns the gauge definitions of the custom metrics, and the gauge of their
+// success when there are any
+func customGauges(custom []CustomMetric) []metrics.Gauge {
+	if len(custom) == 0 {
+		return nil
+	}
+	gauges := []metrics.Gauge{{
+		Name:   CustomMetricSuccess,
+		Desc:   "1 if all endpoints of the custom metric were read, 0 otherwise",
+		Labels: []string{LabelCustomMetric},
+	}}
+	for _, c := range custom {
+		if c.Type == "" || c.Type == CustomGauge {
+			gauges = append(gauges, metrics.Gauge{Name: c.Name, Unit: c.Unit, Desc: c.help(), Labels: c.labelNames()})
+		}
+	}
+	return gauges
+}
+
+// customCounters returns the counter definitions of the custom metrics
+func customCounters(custom []CustomMetric) []metrics.Counter {
+	var counters []metrics.Counter
+	for _, c := range custom {
+		if c.Type == CustomCounter {
+			counters = append(counters, metrics.Counter{Name: c.Name, Unit: c.Unit, Desc: c.help(), Labels: c.labelNames()})
+		}
+	}
+	return counters
+}
+
+func custom(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	if len(opts.CustomMetrics) == 0 {
+		return nil
+	}
+
+	// Custom metrics come from the config file, so a clash with the metrics of the exporter fails
+	// the probe rather than the exporter
+	gauges := metrics.NewGaugeMap(customGauges(opts.CustomMetrics), opts.metricOptions(FamilyCustom))
+	for _, metric := range gauges {
+		if err := registry.Register(metric); err != nil {
+			return fmt.Errorf("registering custom metric: %w", err)
+		}
+		metric.Reset()
+	}
+	counters := metrics.NewCounterValueMap(customCounters(opts.CustomMetrics), opts.metricOptions(FamilyCustom))
+	for _, metric := range counters {
+		if err := registry.Register(metric); err != nil {
+			return fmt.Errorf("registering custom metric: %w", err)
+		}
+		metric.Reset()
+	}
+
+	// Metrics reading the same endpoint or list share one request
+	responses := make(map[string]customResponse)
+	lists := make(map[string]customResponse)
+	get := func(cache map[string]customResponse, key string, fn func() (any, error)) (any, error) {
+		res, ok := cache[key]
+		if !ok {
+			res.v, res.err = fn()
+			if res.err != nil {
+				l.Err(res.err).Str("path", key).Msg("Error getting custom metric endpoint")
+			}
+			cache[key] = res
+		}
+		return res.v, res.err
+	}
+
+	for _, c := range opts.CustomMetrics {
+		// Endpoints that fail are skipped, the metric is exported for the others
+		success := true
+		paths := map[string]string{"": c.Path}
+		if list := c.list(); list != "" {
+			v, err := get(lists, list, func() (any, error) { return customIndexes(ctx, unit, list) })
+			if err != nil {
+				success = false
+			}
+			paths = make(map[string]string)
+			indexes, _ := v.([]string)
+			for _, index := range indexes {
+				paths[index] = strings.ReplaceAll(c.Path, customIndex, index)
+			}
+		}
+
+		// Selectors are checked by Options.Validate
+		selector, _ := parseSelector(c.Selector)
+		valueSelector, _ := parseSelector(c.Value)
+		names := c.labelNames()
+		for _, index := range slices.Sorted(maps.Keys(paths)) {
+			res, err := get(responses, paths[index], func() (any, error) {
+				var res any
+				err := unit.GetJSON(ctx, paths[index], &res)
+				return res, err
+			})
+			if err != nil {
+				success = false
+				continue
+			}
+
+			// Elements with the same label values would overwrite each other, only the first is kept
+			seen := make(map[string]struct{})
+			for _, element := range selector.apply(res) {
+				value, ok := jsonNumber(valueSelector.first(element))
+				if !ok {
+					l.Debug().Str("metric", c.Name).Msg("Custom metric value is not a number, skipping")
+					continue
+				}
+				lvs := make([]string, 0, len(names))
+				for _, name := range names {
+					if name == LabelCustomIndex && index != "" {
+						lvs = append(lvs, index)
+						continue
+					}
+					labelSelector, _ := parseSelector(c.Labels[name])
+					lvs = append(lvs, jsonString(labelSelector.first(element)))
+				}
+				key := strings.Join(lvs, "\xff")
+				if _, ok := seen[key]; ok {
+					l.Warn().Str("metric", c.Name).Strs("labels", lvs).Msg("Custom metric selects several elements with the same labels, skipping")
+					continue
+				}
+				seen[key] = struct{}{}
+				if c.Type == CustomCounter {
+					// The unit reports the count itself, so it is exported as is
+					if !counters[c.Name].Set(value, lvs...) {
+						l.Warn().Str("metric", c.Name).Strs("labels", lvs).Msg("Custom metric labels clash after relabelling, exporting the last value")
+					}
+				} else {
+					gauges[c.Name].WithLabelValues(lvs...).Set(value)
+				}
+			}
+		}
+		gauges[CustomMetricSuccess].WithLabelValues(c.Name).Set(metrics.BoolToFloat64(success))
+	}
+
+	return nil
+}
+
+// customResponse is a decoded response of an endpoint or list read for custom metrics
+type customResponse struct {
+	v   any
+	err error
+}
+
+// customIndexes returns the indexes of the resources of a list
+func customIndexes(ctx context.Context, unit *iss.Unit, list string) ([]string, error) {
+	var indexes []int
+	switch list {
+	case "encoders":
+		res, err := unit.ListEncoders(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range res.Encoders {
+			indexes = append(indexes, e.Index)
+		}
+	case "network_inputs":
+		res, err := unit.ListNetworkInputs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range res.NetworkInputs {
+			indexes = append(indexes, e.Index)
+		}
+	case "video_outputs":
+		res, err := unit.ListVideoOutputs(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range res.VideoOutputs {
+			indexes = append(indexes, e.Index)
+		}
+	default:
+		return nil, fmt.Errorf("unknown list %q", list)
+	}
+
+	ret := make([]string, 0, len(indexes))
+	for _, index := range indexes {
+		ret = append(ret, strconv.Itoa(index))
+	}
+	return ret, nil
+}
+
+// selectorStep is a single step of a selector, a field name, an array index or all array elements
+type selectorStep struct {
+	field string
+	index int
+	all   bool
+}
+
+// selector is a dotted path into a JSON document like a.b[0].c or a.b[*]
+type selector []selectorStep
+
+func parseSelector(s string) (selector, error) {
+	var steps selector
+	if s == "" {
+		return steps, nil
+	}
+	for _, part := range strings.Split(s, ".") {
+		field, rest, bracket := strings.Cut(part, "[")
+		if field != "" {
+			steps = append(steps, selectorStep{field: field})
+		} else if rest == "" {
+			return nil, fmt.Errorf("invalid selector %q", s)
+		}
+		if bracket && rest == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing ]", s)
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid selector %q: missing ]", s)
+			}
+			if idx == "*" {
+				steps = append(steps, selectorStep{all: true})
+			} else {
+				i, err := strconv.Atoi(idx)
+				if err != nil || i < 0 {
+					return nil, fmt.Errorf("invalid selector %q: bad index %q", s, idx)
+				}
+				steps = append(steps, selectorStep{index: i})
+			}
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid selector %q", s)
+			}
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return steps, nil
+}
+
+// apply returns all values of a decoded JSON document matched by the selector
+func (s selector) apply(v any) []any {
+	values := []any{v}
+	for _, step := range s {
+		var next []any
+		for _, v := range values {
+			switch {
+			case step.field != "":
+				if m, ok := v.(map[string]any); ok {
+					if f, ok := m[step.field]; ok {
+						next = append(next, f)
+					}
+				}
+			case step.all:
+				if a, ok := v.([]any); ok {
+					next = append(next, a...)
+				}
+			default:
+				if a, ok := v.([]any); ok && step.index < len(a) {
+					next = append(next, a[step.index])
+				}
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// first returns the first value matched by the selector, or nil
+func (s selector) first(v any) any {
+	if values := s.apply(v); len(values) > 0 {
+		return values[0]
+	}
+	return nil
+}
+
+// jsonNumber converts a decoded JSON value to a metric value. Booleans are 1 or 0 and strings
+// are parsed as numbers.
+func jsonNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case bool:
+		return metrics.BoolToFloat64(v), true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonString converts a decoded JSON value to a label value
+func jsonString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return metrics.BoolToString(v)
+	case nil:
+		return ""
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
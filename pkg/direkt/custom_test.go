@@ -0,0 +1,281 @@
+package direkt
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		in   string
+		want selector
+	}{
+		{"", nil},
+		{"a", selector{{field: "a"}}},
+		{"a.b", selector{{field: "a"}, {field: "b"}}},
+		{"a[0]", selector{{field: "a"}, {index: 0}}},
+		{"a[*].b", selector{{field: "a"}, {all: true}, {field: "b"}}},
+		{"a[1][*]", selector{{field: "a"}, {index: 1}, {all: true}}},
+		{"[2].a", selector{{index: 2}, {field: "a"}}},
+	}
+	for _, tt := range tests {
+		got, err := parseSelector(tt.in)
+		if err != nil {
+			t.Errorf("parseSelector(%q) returned error: %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseSelector(%q) = %+v, want %+v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSelectorInvalid(t *testing.T) {
+	for _, in := range []string{"a.", ".a", "a[", "a[b]", "a[-1]", "a[0]b", "a..b"} {
+		if _, err := parseSelector(in); err == nil {
+			t.Errorf("parseSelector(%q) returned no error", in)
+		}
+	}
+}
+
+const selectorDocument = `{
+	"name": "unit",
+	"paths": [
+		{"interface": "eth0", "rtt": 0.01, "up": true},
+		{"interface": "eth1", "rtt": 0.02, "up": false},
+		{"interface": "eth1", "rtt": 0.03}
+	],
+	"grid": [[1, 2], [3, 4]]
+}`
+
+func TestSelectorApply(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(selectorDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		selector string
+		want     []any
+	}{
+		{"name", []any{"unit"}},
+		{"paths[*].rtt", []any{0.01, 0.02, 0.03}},
+		{"paths[1].interface", []any{"eth1"}},
+		{"paths[*].up", []any{true, false}},
+		{"paths[5].rtt", nil},
+		{"missing", nil},
+		{"name[0]", nil},
+		{"name[*]", nil},
+		{"paths.rtt", nil},
+		{"grid[*][1]", []any{2.0, 4.0}},
+		{"grid[1][*]", []any{3.0, 4.0}},
+	}
+	for _, tt := range tests {
+		s, err := parseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("parseSelector(%q): %v", tt.selector, err)
+		}
+		if got := s.apply(doc); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q.apply() = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+
+	// An empty selector matches the whole document
+	if got := (selector{}).apply(doc); len(got) != 1 || !reflect.DeepEqual(got[0], doc) {
+		t.Errorf("empty selector matched %v", got)
+	}
+}
+
+func TestSelectorFirst(t *testing.T) {
+	var doc any
+	if err := json.Unmarshal([]byte(selectorDocument), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := parseSelector("paths[*].interface")
+	if got := s.first(doc); got != "eth0" {
+		t.Errorf("first() = %v, want eth0", got)
+	}
+	s, _ = parseSelector("paths[*].missing")
+	if got := s.first(doc); got != nil {
+		t.Errorf("first() = %v, want nil", got)
+	}
+}
+
+func TestJSONNumber(t *testing.T) {
+	tests := []struct {
+		in   any
+		want float64
+		ok   bool
+	}{
+		{1.5, 1.5, true},
+		{true, 1, true},
+		{false, 0, true},
+		{"42", 42, true},
+		{"fast", 0, false},
+		{nil, 0, false},
+		{map[string]any{}, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := jsonNumber(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("jsonNumber(%v) = %v, %v, want %v, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCustomDuplicateLabels(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/units/D01234/system/status" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(selectorDocument))
+	}))
+	defer srv.Close()
+	client := iss.New("", "")
+	client.BaseURL = srv.URL + "/"
+
+	opts := Options{CustomMetrics: []CustomMetric{
+		{Name: "path_rtt", Path: "system/status", Selector: "paths[*]", Value: "rtt", Labels: map[string]string{"interface": "interface"}},
+		{Name: "path_count", Type: CustomCounter, Path: "system/status", Selector: "paths[*]", Value: "rtt", Labels: map[string]string{"interface": "interface"}},
+	}}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := custom(context.Background(), zerolog.Nop(), registry, client.Unit("D01234"), opts); err != nil {
+		t.Fatal(err)
+	}
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(families) != 3 {
+		t.Fatalf("got %d metric families, want 3", len(families))
+	}
+
+	// The third path repeats eth1 and is dropped, eth1 keeps the value of the first element
+	for _, mf := range families {
+		if mf.GetName() == "direkt_"+CustomMetricSuccess {
+			continue
+		}
+		values := make(map[string]float64)
+		for _, m := range mf.GetMetric() {
+			v := m.GetGauge().GetValue() + m.GetCounter().GetValue()
+			values[m.GetLabel()[0].GetValue()] = v
+		}
+		want := map[string]float64{"eth0": 0.01, "eth1": 0.02}
+		if !reflect.DeepEqual(values, want) {
+			t.Errorf("%s = %v, want %v", mf.GetName(), values, want)
+		}
+	}
+}
+
+func TestCustomMetricValidate(t *testing.T) {
+	tests := []struct {
+		metric CustomMetric
+		valid  bool
+	}{
+		{CustomMetric{Name: "uptime", Path: "system/status"}, true},
+		{CustomMetric{Name: "encoder_uptime", Path: "encoders/{index}/status"}, true},
+		{CustomMetric{Name: "input_delay", Path: "network_inputs/{index}/status", Labels: map[string]string{"program": "programs[*].id"}}, true},
+		{CustomMetric{Name: "uptime", Path: "system/{index}/status"}, false},
+		{CustomMetric{Name: "uptime", Path: "encoders/{index}/{index}"}, false},
+		{CustomMetric{Name: "uptime", Path: "encoders/{encoder}/status"}, false},
+		{CustomMetric{Name: "uptime", Path: "encoders/{index}/status", Labels: map[string]string{LabelCustomIndex: "index"}}, false},
+		{CustomMetric{Name: "uptime", Path: "/api/v1/units/D01234/system/status"}, false},
+		{CustomMetric{Name: "uptime", Path: "system/status", Type: "summary"}, false},
+		{CustomMetric{Name: "up-time", Path: "system/status"}, false},
+		{CustomMetric{Name: CustomMetricSuccess, Path: "system/status"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.metric.validate(); (err == nil) != tt.valid {
+			t.Errorf("%s %s: validate() = %v, want valid %v", tt.metric.Name, tt.metric.Path, err, tt.valid)
+		}
+	}
+}
+
+func TestCustomIndexPath(t *testing.T) {
+	var requests []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v1/units/D01234/encoders":
+			w.Write([]byte(`{"encoders": [{"index": 0}, {"index": 2}]}`))
+		case "/api/v1/units/D01234/encoders/0/status":
+			w.Write([]byte(`{"uptime": 5}`))
+		case "/api/v1/units/D01234/system/status":
+			w.Write([]byte(`{"uptime": 7}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	client := iss.New("", "")
+	client.BaseURL = srv.URL + "/"
+
+	opts := Options{CustomMetrics: []CustomMetric{
+		{Name: "encoder_uptime", Path: "encoders/{index}/status", Value: "uptime"},
+		{Name: "encoder_uptime_copy", Path: "encoders/{index}/status", Value: "uptime"},
+		{Name: "uptime", Path: "system/status", Value: "uptime"},
+	}}
+	if err := opts.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewRegistry()
+	if err := custom(context.Background(), zerolog.Nop(), registry, client.Unit("D01234"), opts); err != nil {
+		t.Fatal(err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]float64)
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			name := mf.GetName()
+			for _, l := range m.GetLabel() {
+				name += "," + l.GetName() + "=" + l.GetValue()
+			}
+			got[name] = m.GetGauge().GetValue()
+		}
+	}
+	// Encoder 2 has no status, so both encoder metrics report a failed request
+	want := map[string]float64{
+		"direkt_encoder_uptime,index=0":                           5,
+		"direkt_encoder_uptime_copy,index=0":                      5,
+		"direkt_uptime":                                           7,
+		"direkt_custom_metric_success,metric=encoder_uptime":      0,
+		"direkt_custom_metric_success,metric=encoder_uptime_copy": 0,
+		"direkt_custom_metric_success,metric=uptime":              1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// The list and every endpoint are requested once, failed ones included
+	if len(requests) != 4 {
+		t.Errorf("made requests %v, want 4", requests)
+	}
+}
+
+func TestCustomClashIsAnError(t *testing.T) {
+	client := iss.New("", "")
+	opts := Options{CustomMetrics: []CustomMetric{{Name: RequestSuccess, Path: "system/status"}}}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(prometheus.NewGauge(prometheus.GaugeOpts{Name: "direkt_" + RequestSuccess, Help: "Request success"}))
+
+	if err := custom(context.Background(), zerolog.Nop(), registry, client.Unit("D01234"), opts); err == nil {
+		t.Error("custom metric clashing with a registered metric returned no error")
+	}
+}
@@ -2,15 +2,14 @@ package direkt
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
-	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
 )
 
 const (
@@ -18,17 +17,36 @@ const (
 	NetworkInputAudioStatus       = "network_input_audio_status"
 	NetworkInputVideoBitrate      = "network_input_video_bitrate"
 	NetworkInputAudioBitrateBytes = "network_input_audio_bitrate"
+	NetworkInputAudioAdaptive     = "network_input_audio_adaptive_bitrate"
 	NetworkInputBitrate           = "network_input_bitrate"
 	NetworkInputPacketLoss        = "network_input_packet_loss"
-	NetworkInputEndToEndDelay     = "network_input_end_to_end_delay_seconds"
-	NetworkInputBuffersReception  = "network_input_buffers_reception_seconds"
-	NetworkInputBuffersDecoder    = "network_input_buffers_decoder_seconds"
-	NetworkInputBuffersTarget     = "network_input_buffers_target_seconds"
-	NetworkInputFecBuffer         = "network_input_fec_buffer_seconds"
+	NetworkInputEndToEndDelay     = "network_input_end_to_end_delay"
+	NetworkInputEndToEndTarget    = "network_input_end_to_end_delay_target"
+	NetworkInputEndToEndDeviation = "network_input_end_to_end_delay_deviation"
+	NetworkInputBuffersReception  = "network_input_buffers_reception"
+	NetworkInputBuffersDecoder    = "network_input_buffers_decoder"
+	NetworkInputBuffersTarget     = "network_input_buffers_target"
+	NetworkInputFecBuffer         = "network_input_fec_buffer"
 	NetworkInputFecPacketLoss     = "network_input_fec_packet_loss"
-	NetworkInputBondingBuffer     = "network_input_bonding_buffer_seconds"
+	NetworkInputBondingBuffer     = "network_input_bonding_buffer"
 	NetworkInputBondingPaths      = "network_input_bonding_paths"
+	NetworkInputBondingPathActive = "network_input_bonding_path_active"
+	NetworkInputBondingPathRate   = "network_input_bonding_path_bitrate"
+	NetworkInputBondingPathLoss   = "network_input_bonding_path_packet_loss"
+	NetworkInputBondingPathDelay  = "network_input_bonding_path_latency"
 	NetworkInputActive            = "network_input_active"
+	NetworkInputVideoInfo         = "network_input_video_info"
+	NetworkInputVideoWidth        = "network_input_video_width"
+	NetworkInputVideoHeight       = "network_input_video_height"
+	NetworkInputVideoFramerate    = "network_input_video_framerate"
+	NetworkInputEncrypted         = "network_input_encrypted"
+	NetworkInputSenderVerified    = "network_input_sender_verified"
+	NetworkInputSenderInfo        = "network_input_sender_info"
+	NetworkInputRTMPConnected     = "network_input_rtmp_destination_connected"
+	NetworkInputRTMPBitrate       = "network_input_rtmp_destination_bitrate"
+	NetworkInputRTMPReconnects    = "network_input_rtmp_destination_reconnects"
+	NetworkInputSourceType        = "network_input_source_type"
+	NetworkInputProgramInfo       = "network_input_program_info"
 )
 
 const (
@@ -52,118 +70,302 @@ var networkInputMetrics = []metrics.Gauge{
 	{
 		Name:   NetworkInputVideoStatus,
 		Desc:   "Video input status (1=active, 0=inactive)",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelCodec, LabelProfile, LabelCodecLevel, LabelChromaSubsampling, LabelFramerate, LabelWidth, LabelHeight, LabelBitDepth, LabelInterlaced, LabelTopFieldFirst, LabelDisplayAspect, LabelPixelAspect, LabelForcedAspect, LabelProgramIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelCodec, LabelProfile, LabelCodecLevel, LabelChromaSubsampling, LabelFramerate, LabelWidth, LabelHeight, LabelBitDepth, LabelInterlaced, LabelTopFieldFirst, LabelDisplayAspect, LabelPixelAspect, LabelForcedAspect, LabelProgramIndex, LabelProgramID},
 	},
 	{
 		Name:   NetworkInputAudioStatus,
 		Desc:   "Audio input status (1=active, 0=inactive)",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelCodec, LabelChannels, LabelSampleRate, LabelBitDepth, LabelProgramIndex, LevelAudioIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelCodec, LabelChannels, LabelSampleRate, LabelBitDepth, LabelProgramIndex, LabelProgramID, LevelAudioIndex},
 	},
 	{
 		Name:   NetworkInputVideoBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "network_input_video_bitrate",
 		Desc:   "Video codec bitrate in bits per second",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputAudioBitrateBytes,
+		Unit:   metrics.UnitBitsPerSecond,
+		Desc:   "Audio codec bitrate in bits per second",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID, LevelAudioIndex},
+	},
+	{
+		Name:   NetworkInputAudioAdaptive,
+		Desc:   "Boolean indicating if the audio codec uses adaptive bitrate (1 = yes, 0 = no)",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID, LevelAudioIndex},
 	},
-	// {
-	// 	Name:   NetworkInputAudioBitrateBytes,
-	// 	Desc:   "Audio codec bitrate in bytes",
-	// 	Labels: []string{LabelInputIndex, LabelInputName, LabelCodec, LabelProgramNumber},
-	// },
 	{
 		Name:   NetworkInputBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "network_input_bitrate",
 		Desc:   "Total network input bitrate in bits per second",
 		Labels: []string{LabelInputIndex, LabelInputName, LabelSourceType, LabelSenderSerial},
 	},
 	{
 		Name:   NetworkInputPacketLoss,
+		Unit:   metrics.UnitRatio,
+		Legacy: "network_input_packet_loss",
 		Desc:   "Network input packet loss",
 		Labels: []string{LabelInputIndex, LabelInputName},
 	},
 	{
 		Name:   NetworkInputEndToEndDelay,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "End-to-end delay for the input in seconds",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelTarget},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputEndToEndTarget,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "Target end-to-end delay for the input in seconds",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputEndToEndDeviation,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "Difference between the end-to-end delay and its target in seconds. Positive when the delay is above target",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
 	},
 	{
 		Name:   NetworkInputBuffersReception,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "Reception buffer duration in seconds",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
 	},
 	{
 		Name:   NetworkInputBuffersDecoder,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "Decoder buffer duration in seconds",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
 	},
 	{
 		Name:   NetworkInputBuffersTarget,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "Target buffer duration in seconds",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputProgramInfo,
+		Desc:   "Program of the transport stream with its program ID and video codec as labels. Value is always 1",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID, LabelCodec},
 	},
 	{
 		Name:   NetworkInputFecBuffer,
-		Desc:   "FEC buffer duration in seconds",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Unit:   metrics.UnitSeconds,
+		Desc:   "FEC buffer duration in seconds. The unit reports FEC per network input, not per program",
+		Labels: []string{LabelInputIndex, LabelInputName},
 	},
 	{
 		Name:   NetworkInputFecPacketLoss,
-		Desc:   "FEC packet loss",
-		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex},
+		Unit:   metrics.UnitRatio,
+		Legacy: "network_input_fec_packet_loss",
+		Desc:   "FEC packet loss. The unit reports FEC per network input, not per program",
+		Labels: []string{LabelInputIndex, LabelInputName},
 	},
 	{
 		Name:   NetworkInputBondingBuffer,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "Bonding buffer duration in seconds",
 		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol},
 	},
+	{
+		Name:   NetworkInputBondingPaths,
+		Desc:   "Number of bonding paths the input is receiving on",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol},
+	},
+	{
+		Name:   NetworkInputBondingPathActive,
+		Desc:   "Indicates if the bonding path is active (1=active, 0=inactive)",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol, LabelAddress},
+	},
+	{
+		Name:   NetworkInputBondingPathRate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "network_input_bonding_path_bitrate_bits",
+		Desc:   "Received bitrate on the bonding path in bits per second",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol, LabelAddress},
+	},
+	{
+		Name:   NetworkInputBondingPathLoss,
+		Unit:   metrics.UnitRatio,
+		Legacy: "network_input_bonding_path_packet_loss",
+		Desc:   "Packet loss ratio (0-1) on the bonding path",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol, LabelAddress},
+	},
+	{
+		Name:   NetworkInputBondingPathDelay,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "Latency on the bonding path in seconds",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol, LabelAddress},
+	},
 	{
 		Name:   NetworkInputActive,
 		Desc:   "Indicates if the network input is active (1=active, 0=inactive)",
 		Labels: []string{LabelInputIndex, LabelInputName, LabelSourceType, LabelAddress, LabelSenderSerial, LabelSenderVerified},
 	},
+	// The encryption and sender metrics were introduced with the namespace, so legacy names keep it
+	{
+		Name:   NetworkInputEncrypted,
+		Legacy: "direkt_network_input_encrypted",
+		Desc:   "Indicates if the network input stream is encrypted (1=encrypted, 0=unencrypted)",
+		Labels: []string{LabelInputIndex, LabelInputName},
+	},
+	{
+		Name:   NetworkInputSenderVerified,
+		Legacy: "direkt_network_input_sender_verified",
+		Desc:   "Indicates if the sender of the network input has been verified (1=verified, 0=unverified)",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelSenderSerial},
+	},
+	{
+		Name:   NetworkInputSenderInfo,
+		Legacy: "direkt_network_input_sender_info",
+		Desc:   "Information about the sender of the network input. Value is always 1",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelSenderSerial, LabelSourceType, LabelAddress},
+	},
+	{
+		Name:   NetworkInputRTMPConnected,
+		Desc:   "Indicates if the RTMP destination is connected (1=connected, 0=disconnected)",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelRTMPHost, LabelDestinationIndex},
+	},
+	{
+		Name:   NetworkInputRTMPBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "network_input_rtmp_destination_bitrate_bits",
+		Desc:   "Output bitrate to an RTMP destination in bits per second",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelRTMPHost, LabelDestinationIndex},
+	},
+	{
+		Name:       NetworkInputRTMPReconnects,
+		LegacyOnly: true,
+		Desc:       "Number of times the RTMP destination has reconnected",
+		Labels:     []string{LabelInputIndex, LabelInputName, LabelRTMPHost, LabelDestinationIndex},
+	},
 }
 
-func decoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error {
-	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/network_inputs", url, unitEndpoint, id), nil)
-	if err != nil {
-		return err
-	}
+// Byte counters integrated from bitrates when the unit is polled
+const (
+	NetworkInputReceived            = "network_input_received"
+	NetworkInputBondingPathReceived = "network_input_bonding_path_received"
+)
 
-	res, err := doReq(l, request)
-	if err != nil {
-		return err
+var networkInputCounters = []metrics.Counter{
+	{
+		Name:   NetworkInputReceived,
+		Unit:   metrics.UnitBytes,
+		Desc:   "Bytes received by the network input, integrated from the input bitrate between polls",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelSourceType, LabelSenderSerial},
+	},
+	{
+		Name:   NetworkInputBondingPathReceived,
+		Unit:   metrics.UnitBytes,
+		Desc:   "Bytes received on the bonding path, integrated from the path bitrate between polls",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProtocol, LabelAddress},
+	},
+}
+
+// networkInputMetricsLegacy keeps the target label of the end-to-end delay for dashboards
+// using legacy names with the v1 schema
+var networkInputMetricsLegacy = []metrics.Gauge{
+	{
+		Name:   NetworkInputEndToEndDelay,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "End-to-end delay for the input in seconds",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID, LabelTarget},
+	},
+}
+
+// networkInputGauges returns the network input gauges for the selected schema and names
+func networkInputGauges(o Options) []metrics.Gauge {
+	if o.LegacyNames && o.Schema != SchemaV2 {
+		return withOverrides(networkInputMetrics, networkInputMetricsLegacy)
 	}
+	return withSchema(o.Schema, networkInputMetrics, networkInputMetricsV2)
+}
+
+// Counters of cumulative values reported by the unit. They replace gauges of the same name, so
+// legacy names keep the namespace to tell them apart.
+var networkInputReportedCounters = []metrics.Counter{
+	{
+		Name:   NetworkInputRTMPReconnects,
+		Legacy: "direkt_" + NetworkInputRTMPReconnects,
+		Desc:   "Number of times the RTMP destination has reconnected",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelRTMPHost, LabelDestinationIndex},
+	},
+}
+
+// networkInputMetricsV2 replaces the label-heavy video gauges of networkInputMetrics when the v2 schema is selected
+var networkInputMetricsV2 = []metrics.Gauge{
+	{
+		Name:   NetworkInputVideoStatus,
+		Desc:   "Video input status (1=active, 0=inactive)",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputVideoInfo,
+		Desc:   "Video input codec and format properties as labels. Value is always 1",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID, LabelCodec, LabelProfile, LabelCodecLevel, LabelChromaSubsampling, LabelBitDepth, LabelInterlaced, LabelTopFieldFirst, LabelDisplayAspect, LabelPixelAspect, LabelForcedAspect},
+	},
+	{
+		Name:   NetworkInputVideoWidth,
+		Unit:   metrics.UnitPixels,
+		Desc:   "Video input width in pixels",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputVideoHeight,
+		Unit:   metrics.UnitPixels,
+		Desc:   "Video input height in pixels",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+	{
+		Name:   NetworkInputVideoFramerate,
+		Desc:   "Video input framerate in frames per second",
+		Labels: []string{LabelInputIndex, LabelInputName, LabelProgramIndex, LabelProgramID},
+	},
+}
 
-	var decoders models.NetworkInputsResponse
-	err = json.Unmarshal(res, &decoders)
+var networkInputStateSets = []metrics.StateSet{
+	{
+		Name:   NetworkInputSourceType,
+		Desc:   "Type of the network source received by the input",
+		Labels: []string{LabelInputIndex, LabelInputName},
+		States: []string{"bonding", "udp", "rtp", "srt", "rtmp"},
+	},
+}
+
+func decoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	decoders, err := unit.ListNetworkInputs(ctx)
 	if err != nil {
 		return err
 	}
 
-	mtrcs := metrics.NewGaugeMap(networkInputMetrics)
+	mtrcs := metrics.NewGaugeMap(networkInputGauges(opts), opts.metricOptions(FamilyNetworkInput))
 	for _, metric := range mtrcs {
 		registry.MustRegister(metric)
 		metric.Reset()
 	}
+	stateSets := metrics.NewStateSetMap(networkInputStateSets, opts.metricOptions(FamilyNetworkInput))
+	for _, metric := range stateSets {
+		registry.MustRegister(metric)
+		metric.Reset()
+	}
+	counters := metrics.NewCounterValueMap(networkInputReportedCounters, opts.metricOptions(FamilyNetworkInput))
+	for _, metric := range counters {
+		registry.MustRegister(metric)
+	}
+	integrators := opts.state.registerIntegrators(registry, FamilyNetworkInput)
+	now := time.Now()
 
 	for _, decoder := range decoders.NetworkInputs {
-		request, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/network_inputs/%d/status", url, unitEndpoint, id, decoder.Index), nil)
-		if err != nil {
-			l.Err(err).Int("encoder_index", decoder.Index).Msg("Error creating encoder request, skipping")
-			continue
-		}
-		res, err := doReq(l, request)
+		e, err := unit.GetNetworkInputStatus(ctx, decoder)
 		if err != nil {
 			l.Err(err).Int("encoder_index", decoder.Index).Msg("Error getting encoder metrics, skipping")
 			continue
 		}
 
-		var e models.NetworkInputStatus
-		err = json.Unmarshal(res, &e)
-		if err != nil {
-			l.Err(err).Int("encoder_index", decoder.Index).Msg("Error decoding encoder status response, skipping")
-			continue
-		}
-
 		decoderIdx := strconv.Itoa(decoder.Index)
+		stateSets[NetworkInputSourceType].Set(e.NetworkSource.SourceType, decoderIdx, e.Description)
 
 		mtrcs[NetworkInputActive].WithLabelValues(
 			decoderIdx,
@@ -181,13 +383,43 @@ func decoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 			e.NetworkSource.Sender.Serial,
 		).Set(float64(e.NetworkSource.Bitrate))
 
+		if integrators != nil {
+			integrators[NetworkInputReceived].Observe(
+				now,
+				float64(e.NetworkSource.Bitrate)/8,
+				decoderIdx,
+				e.Description,
+				e.NetworkSource.SourceType,
+				e.NetworkSource.Sender.Serial,
+			)
+		}
+
 		mtrcs[NetworkInputPacketLoss].WithLabelValues(
 			decoderIdx,
 			e.Description,
 		).Set(e.NetworkSource.PacketLoss)
 
-		mtrcs[NetworkInputFecBuffer].WithLabelValues(decoderIdx, e.Description, "0").Set(e.NetworkSource.FEC.Buffer)
-		mtrcs[NetworkInputFecPacketLoss].WithLabelValues(decoderIdx, e.Description, "0").Set(e.NetworkSource.FEC.PacketLoss)
+		mtrcs[NetworkInputEncrypted].WithLabelValues(
+			decoderIdx,
+			e.Description,
+		).Set(metrics.BoolToFloat64(e.NetworkSource.Encrypted))
+
+		mtrcs[NetworkInputSenderVerified].WithLabelValues(
+			decoderIdx,
+			e.Description,
+			e.NetworkSource.Sender.Serial,
+		).Set(metrics.BoolToFloat64(e.NetworkSource.Sender.Verified))
+
+		mtrcs[NetworkInputSenderInfo].WithLabelValues(
+			decoderIdx,
+			e.Description,
+			e.NetworkSource.Sender.Serial,
+			e.NetworkSource.SourceType,
+			e.NetworkSource.Address,
+		).Set(1)
+
+		mtrcs[NetworkInputFecBuffer].WithLabelValues(decoderIdx, e.Description).Set(e.NetworkSource.FEC.Buffer)
+		mtrcs[NetworkInputFecPacketLoss].WithLabelValues(decoderIdx, e.Description).Set(e.NetworkSource.FEC.PacketLoss)
 
 		if e.NetworkSource.Bonding.Protocol != "" {
 			mtrcs[NetworkInputBondingBuffer].WithLabelValues(
@@ -195,37 +427,87 @@ func decoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 				e.Description,
 				e.NetworkSource.Bonding.Protocol,
 			).Set(e.NetworkSource.Bonding.Buffer)
+
+			bonding := e.NetworkSource.Bonding
+			mtrcs[NetworkInputBondingPaths].WithLabelValues(decoderIdx, e.Description, bonding.Protocol).Set(float64(len(bonding.Paths)))
+			for _, path := range bonding.Paths {
+				mtrcs[NetworkInputBondingPathActive].WithLabelValues(decoderIdx, e.Description, bonding.Protocol, path.Address).Set(metrics.BoolToFloat64(path.Active))
+				mtrcs[NetworkInputBondingPathRate].WithLabelValues(decoderIdx, e.Description, bonding.Protocol, path.Address).Set(path.Bitrate)
+				if integrators != nil {
+					integrators[NetworkInputBondingPathReceived].Observe(now, path.Bitrate/8, decoderIdx, e.Description, bonding.Protocol, path.Address)
+				}
+				mtrcs[NetworkInputBondingPathLoss].WithLabelValues(decoderIdx, e.Description, bonding.Protocol, path.Address).Set(path.PacketLoss)
+				mtrcs[NetworkInputBondingPathDelay].WithLabelValues(decoderIdx, e.Description, bonding.Protocol, path.Address).Set(path.Latency)
+			}
+		}
+
+		for i, rtmp := range e.Destinations.RTMP {
+			destinationIdx := strconv.Itoa(i)
+			host := rtmpHost(rtmp.URL)
+			mtrcs[NetworkInputRTMPConnected].WithLabelValues(decoderIdx, e.Description, host, destinationIdx).Set(metrics.BoolToFloat64(rtmp.Connected))
+			mtrcs[NetworkInputRTMPBitrate].WithLabelValues(decoderIdx, e.Description, host, destinationIdx).Set(rtmp.Bitrate)
+			counters[NetworkInputRTMPReconnects].Set(float64(rtmp.Reconnects), decoderIdx, e.Description, host, destinationIdx)
+			if opts.LegacyNames {
+				mtrcs[NetworkInputRTMPReconnects].WithLabelValues(decoderIdx, e.Description, host, destinationIdx).Set(float64(rtmp.Reconnects))
+			}
 		}
 
-		for progIndex, prog := range e.NetworkSource.Programs {
-			progIdxStr := fmt.Sprintf("%d", progIndex)
+		for _, prog := range e.NetworkSource.Programs {
+			// Programs are labelled with both their number and ID from the transport stream
+			programNumber := strconv.Itoa(prog.Number)
+			mtrcs[NetworkInputProgramInfo].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID, prog.Video.Codec.Name).Set(1)
 
 			// Video status
 			video := prog.Video
-			mtrcs[NetworkInputVideoStatus].WithLabelValues(
-				decoderIdx,
-				e.Description,
-				video.Codec.Name,
-				video.Codec.Profile,
-				video.Codec.Level,
-				video.Format.ChromaSubsampling,
-				fmt.Sprintf("%.2f", video.Format.Framerate),
-				strconv.Itoa(video.Format.Width),
-				strconv.Itoa(video.Format.Height),
-				strconv.Itoa(video.Format.BitDepth),
-				metrics.BoolToString(video.Format.Interlaced),
-				metrics.BoolToString(video.Format.TopFieldFirst),
-				video.Format.DisplayAspect,
-				video.Format.PixelAspect,
-				metrics.BoolToString(video.Format.ForcedAspect),
-				progIdxStr,
-			).Set(metrics.BoolToFloat64(e.Active))
+			if opts.Schema == SchemaV2 {
+				mtrcs[NetworkInputVideoStatus].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(metrics.BoolToFloat64(e.Active))
+				mtrcs[NetworkInputVideoInfo].WithLabelValues(
+					decoderIdx,
+					e.Description,
+					programNumber,
+					prog.ID,
+					video.Codec.Name,
+					video.Codec.Profile,
+					video.Codec.Level,
+					video.Format.ChromaSubsampling,
+					strconv.Itoa(video.Format.BitDepth),
+					metrics.BoolToString(video.Format.Interlaced),
+					metrics.BoolToString(video.Format.TopFieldFirst),
+					video.Format.DisplayAspect,
+					video.Format.PixelAspect,
+					metrics.BoolToString(video.Format.ForcedAspect),
+				).Set(1)
+				mtrcs[NetworkInputVideoWidth].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(float64(video.Format.Width))
+				mtrcs[NetworkInputVideoHeight].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(float64(video.Format.Height))
+				mtrcs[NetworkInputVideoFramerate].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(video.Format.Framerate)
+			} else {
+				mtrcs[NetworkInputVideoStatus].WithLabelValues(
+					decoderIdx,
+					e.Description,
+					video.Codec.Name,
+					video.Codec.Profile,
+					video.Codec.Level,
+					video.Format.ChromaSubsampling,
+					fmt.Sprintf("%.2f", video.Format.Framerate),
+					strconv.Itoa(video.Format.Width),
+					strconv.Itoa(video.Format.Height),
+					strconv.Itoa(video.Format.BitDepth),
+					metrics.BoolToString(video.Format.Interlaced),
+					metrics.BoolToString(video.Format.TopFieldFirst),
+					video.Format.DisplayAspect,
+					video.Format.PixelAspect,
+					metrics.BoolToString(video.Format.ForcedAspect),
+					programNumber,
+					prog.ID,
+				).Set(metrics.BoolToFloat64(e.Active))
+			}
 
 			// Input bitrate
 			mtrcs[NetworkInputVideoBitrate].WithLabelValues(
 				decoderIdx,
 				e.Description,
-				progIdxStr,
+				programNumber,
+				prog.ID,
 			).Set(float64(video.Codec.Bitrate))
 
 			// Audio status
@@ -238,20 +520,33 @@ func decoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 					strconv.Itoa(audio.Format.Channels),
 					strconv.Itoa(audio.Format.SampleRate),
 					strconv.Itoa(audio.Format.BitDepth),
-					progIdxStr,
+					programNumber,
+					prog.ID,
 					audioIdxStr,
 				).Set(metrics.BoolToFloat64(e.Active))
+				mtrcs[NetworkInputAudioBitrateBytes].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID, audioIdxStr).Set(float64(audio.Codec.Bitrate))
+				mtrcs[NetworkInputAudioAdaptive].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID, audioIdxStr).Set(metrics.BoolToFloat64(audio.Codec.AdaptiveBitrate))
 			}
 
 			// Buffers
-			mtrcs[NetworkInputBuffersReception].WithLabelValues(decoderIdx, e.Description, progIdxStr).Set(prog.Buffers.Reception)
-			mtrcs[NetworkInputBuffersDecoder].WithLabelValues(decoderIdx, e.Description, progIdxStr).Set(prog.Buffers.Decoder)
-			mtrcs[NetworkInputBuffersTarget].WithLabelValues(decoderIdx, e.Description, progIdxStr).Set(prog.Buffers.Target)
+			mtrcs[NetworkInputBuffersReception].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(prog.Buffers.Reception)
+			mtrcs[NetworkInputBuffersDecoder].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(prog.Buffers.Decoder)
+			mtrcs[NetworkInputBuffersTarget].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(prog.Buffers.Target)
 
 			// End-to-end delay
-			mtrcs[NetworkInputEndToEndDelay].WithLabelValues(decoderIdx, e.Description, progIdxStr, fmt.Sprintf("%.4f", prog.EndToEndDelay.Target)).Set(prog.EndToEndDelay.Delay)
+			delay := prog.EndToEndDelay
+			if opts.LegacyNames && opts.Schema != SchemaV2 {
+				mtrcs[NetworkInputEndToEndDelay].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID, fmt.Sprintf("%.4f", delay.Target)).Set(delay.Delay)
+			} else {
+				mtrcs[NetworkInputEndToEndDelay].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(delay.Delay)
+			}
+			mtrcs[NetworkInputEndToEndTarget].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(delay.Target)
+			mtrcs[NetworkInputEndToEndDeviation].WithLabelValues(decoderIdx, e.Description, programNumber, prog.ID).Set(delay.Delay - delay.Target)
 		}
 	}
+	for _, integrator := range integrators {
+		integrator.Prune(now)
+	}
 
 	return err
 }
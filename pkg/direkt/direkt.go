@@ -1,41 +1,298 @@
 package direkt
 
 import (
+	"compress/gzip"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+	"golang.org/x/sync/singleflight"
 )
 
+// Schema selects the layout of the video status metrics
+type Schema string
+
 const (
-	url          = "https://iss.intinor.se/"
-	unitEndpoint = "api/v1/units/"
+	// SchemaV1 exposes video format and codec properties as labels on the status gauges
+	SchemaV1 Schema = "v1"
+	// SchemaV2 keeps only identity labels on the status gauges and moves format and codec
+	// properties to separate *_info metrics and numeric gauges
+	SchemaV2 Schema = "v2"
 )
 
-var errUnitOffline = errors.New("unit offline")
+// ParseSchema validates a schema name given on the command line
+func ParseSchema(s string) (Schema, error) {
+	switch Schema(s) {
+	case SchemaV1, SchemaV2:
+		return Schema(s), nil
+	}
+	return "", fmt.Errorf("unknown metric schema %q", s)
+}
+
+// Options holds settings that change which metrics are exported
+type Options struct {
+	Schema Schema
+	// LegacyNames exports metrics under their names from before the direkt_ namespace
+	// and unit suffixes were introduced
+	LegacyNames bool
+	// Limits guards against label values from the unit producing too many series
+	Limits metrics.Limits
+	// Labels rewrites the labels of each metric family, keyed by family name
+	Labels map[string]metrics.LabelConfig
+	// ExtraLabels are static labels added to every metric
+	ExtraLabels map[string]string
+	// AnalyseThumbnails exports whether the thumbnails of polled units are black or frozen
+	AnalyseThumbnails bool
+	// CustomMetrics exports fields of endpoints the exporter doesn't collect itself
+	CustomMetrics []CustomMetric
+
+	// state holds metrics carried between polls of a unit, nil when answering a probe directly
+	state *unitState
+}
+
+// Metric families whose labels can be rewritten
+const (
+	FamilySystem       = "system"
+	FamilyInterface    = "interface"
+	FamilyEncoder      = "encoder"
+	FamilyNetworkInput = "network_input"
+	FamilyVideoOutput  = "video_output"
+	FamilyThumbnail    = "thumbnail"
+	FamilyResource     = "resource"
+	FamilyCustom       = "custom"
+	FamilyRequest      = "request"
+)
+
+func (o Options) counterFamilies() map[string][]metrics.Counter {
+	return map[string][]metrics.Counter{
+		FamilyEncoder:      slices.Concat(encoderCounters, encoderReportedCounters),
+		FamilyNetworkInput: slices.Concat(networkInputCounters, networkInputReportedCounters),
+		FamilyCustom:       customCounters(o.CustomMetrics),
+	}
+}
+
+func (o Options) histogramFamilies() map[string][]metrics.Histogram {
+	return map[string][]metrics.Histogram{
+		FamilyEncoder: encoderHistograms,
+	}
+}
+
+func (o Options) stateSetFamilies() map[string][]metrics.StateSet {
+	return map[string][]metrics.StateSet{
+		FamilySystem:       sysStateSets,
+		FamilyInterface:    interfaceStateSets,
+		FamilyNetworkInput: networkInputStateSets,
+	}
+}
+
+func (o Options) families() map[string][]metrics.Gauge {
+	return map[string][]metrics.Gauge{
+		FamilySystem:       sysMetrics,
+		FamilyInterface:    interfaceMetrics,
+		FamilyEncoder:      withSchema(o.Schema, encoderMetrics, encoderMetricsV2),
+		FamilyNetworkInput: networkInputGauges(o),
+		FamilyVideoOutput:  withSchema(o.Schema, videoMetrics, videoMetricsV2),
+		FamilyThumbnail:    thumbnailMetrics,
+		FamilyResource:     resourceMetrics,
+		FamilyCustom:       customGauges(o.CustomMetrics),
+		FamilyRequest:      requestMetrics,
+	}
+}
+
+// units maps the exported name of every metric with a unit to that unit. OpenMetrics requires
+// names to end in their unit, so legacy names that don't are left without one rather than being
+// renamed by the encoder.
+func (o Options) units() map[string]string {
+	units := make(map[string]string)
+	add := func(name, unit string) {
+		if unit != "" && strings.HasSuffix(name, "_"+unit) {
+			units[name] = unit
+		}
+	}
+	for _, gauges := range o.families() {
+		for _, g := range gauges {
+			add(g.FQName(o.LegacyNames), g.Unit)
+		}
+	}
+	for _, counters := range o.counterFamilies() {
+		for _, c := range counters {
+			// The family of a counter is named without _total
+			add(strings.TrimSuffix(c.FQName(o.LegacyNames), "_total"), c.Unit)
+		}
+	}
+	for _, histograms := range o.histogramFamilies() {
+		for _, h := range histograms {
+			add(metrics.Gauge{Name: h.Name, Unit: h.Unit}.FQName(o.LegacyNames), h.Unit)
+		}
+	}
+	return units
+}
+
+// metricOptions returns the options used to build the metrics of a family
+func (o Options) metricOptions(family string) metrics.Options {
+	return metrics.Options{
+		LegacyNames: o.LegacyNames,
+		Limits:      o.Limits,
+		Labels:      o.Labels[family],
+	}
+}
+
+// constLabels returns the labels added to every metric of a unit
+func (o Options) constLabels(id string) prometheus.Labels {
+	labels := prometheus.Labels{"serial": id}
+	for name, value := range o.ExtraLabels {
+		labels[name] = value
+	}
+	return labels
+}
+
+// reservedLabels returns the label names the exporter sets itself, which static labels must not
+// replace
+func (o Options) reservedLabels() map[string]bool {
+	reserved := map[string]bool{"serial": true, metrics.LabelState: true}
+	add := func(family string, labels []string) {
+		for _, label := range labels {
+			reserved[label] = true
+		}
+		for _, label := range o.Labels[family].Rename {
+			reserved[label] = true
+		}
+	}
+	for family, gauges := range o.families() {
+		for _, g := range gauges {
+			add(family, g.Labels)
+		}
+	}
+	for family, counters := range o.counterFamilies() {
+		for _, c := range counters {
+			add(family, c.Labels)
+		}
+	}
+	for family, histograms := range o.histogramFamilies() {
+		for _, h := range histograms {
+			add(family, h.Labels)
+		}
+	}
+	for family, stateSets := range o.stateSetFamilies() {
+		for _, s := range stateSets {
+			add(family, s.Labels)
+		}
+	}
+	return reserved
+}
+
+// Validate checks the label configuration by registering every metric family once, so
+// clashing or invalid label names are reported at startup rather than on a probe
+func (o Options) Validate() error {
+	families := o.families()
+	for family := range o.Labels {
+		if _, ok := families[family]; !ok {
+			return fmt.Errorf("unknown metric family %q", family)
+		}
+	}
+
+	customNames := make(map[string]bool, len(o.CustomMetrics))
+	for _, c := range o.CustomMetrics {
+		if err := c.validate(); err != nil {
+			return err
+		}
+		if customNames[c.Name] {
+			return fmt.Errorf("custom metric %s is declared twice", c.Name)
+		}
+		customNames[c.Name] = true
+	}
+
+	for family := range o.stateSetFamilies() {
+		if slices.Contains(o.Labels[family].Drop, metrics.LabelState) {
+			return fmt.Errorf("metric family %s: label %q of state sets can't be dropped", family, metrics.LabelState)
+		}
+	}
 
-func New(username, password string) *Direkt {
+	reserved := o.reservedLabels()
+	for name := range o.ExtraLabels {
+		if reserved[name] {
+			return fmt.Errorf("extra label %q is reserved for a label of the exporter", name)
+		}
+	}
+	for family, config := range o.Labels {
+		for name := range config.ExtraLabels {
+			if reserved[name] {
+				return fmt.Errorf("metric family %s: extra label %q is reserved for a label of the exporter", family, name)
+			}
+		}
+	}
+
+	registry := prometheus.WrapRegistererWith(o.constLabels("D0"), prometheus.NewRegistry())
+	for family, gauges := range families {
+		for _, metric := range metrics.NewGaugeMap(gauges, o.metricOptions(family)) {
+			if err := registry.Register(metric); err != nil {
+				return fmt.Errorf("metric family %s: %w", family, err)
+			}
+		}
+	}
+	for family, counters := range o.counterFamilies() {
+		for _, metric := range metrics.NewCounterMap(counters, o.metricOptions(family)) {
+			if err := registry.Register(metric); err != nil {
+				return fmt.Errorf("metric family %s: %w", family, err)
+			}
+		}
+	}
+	for family, histograms := range o.histogramFamilies() {
+		for _, metric := range metrics.NewHistogramMap(histograms, o.metricOptions(family)) {
+			if err := registry.Register(metric); err != nil {
+				return fmt.Errorf("metric family %s: %w", family, err)
+			}
+		}
+	}
+	for family, stateSets := range o.stateSetFamilies() {
+		for _, metric := range metrics.NewStateSetMap(stateSets, o.metricOptions(family)) {
+			if err := registry.Register(metric); err != nil {
+				return fmt.Errorf("metric family %s: %w", family, err)
+			}
+		}
+	}
+	return nil
+}
+
+func New(username, password string, opts Options) *Direkt {
 	return &Direkt{
-		username: username,
-		password: password,
-		client: http.Client{
-			Timeout: 15 * time.Second,
-		},
+		client:     iss.New(username, password),
+		opts:       opts,
+		polled:     make(map[string]polledMetrics),
+		units:      opts.units(),
+		thumbnails: make(map[string]thumbnail),
 	}
 }
 
 type Direkt struct {
-	username string
-	password string
-	client   http.Client
+	client *iss.Client
+	opts   Options
+
+	mu     sync.Mutex
+	polled map[string]polledMetrics
+
+	// units maps exported metric names to their unit for the metric metadata
+	units map[string]string
+
+	thumbnailMu sync.Mutex
+	thumbnails  map[string]thumbnail
+	// thumbnailFetches collapses concurrent fetches of the same thumbnail
+	thumbnailFetches singleflight.Group
 }
 
+var gatherers = []metricGatherer{resources, system, interfaces, decoders, outputs, encoders, analyseThumbnails, custom}
+
 func (d *Direkt) Handle(w http.ResponseWriter, r *http.Request, l zerolog.Logger) {
 	id, err := validateRequest(r)
 	if err != nil {
@@ -44,78 +301,131 @@ func (d *Direkt) Handle(w http.ResponseWriter, r *http.Request, l zerolog.Logger
 		l.Err(err).Msg("Error validating request parameters")
 		return
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
 
-	registry, err := d.gatherMetrics(ctx, l.With().Str("serial", id).Logger(), []metricGatherer{system, interfaces, decoders, outputs, encoders}, id)
+	var registry *prometheus.Registry
+	var timestamp time.Time
+	if p, ok := d.lastPoll(id); ok {
+		l.Debug().Str("serial", id).Msg("Serving metrics from last poll")
+		registry, err, timestamp = p.registry, p.err, p.timestamp
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		registry, err = d.gatherMetrics(ctx, l.With().Str("serial", id).Logger(), gatherers, id, nil)
+	}
 	if err != nil {
 		w.Write([]byte(err.Error()))
 		// w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	h := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
-	h.ServeHTTP(w, r)
+	d.serveMetrics(w, r, l, registry, timestamp)
 }
 
-func (d *Direkt) doRequest(l zerolog.Logger, req *http.Request) ([]byte, error) {
-	if d.username != "" && d.password != "" {
-		l.Debug().Msg("Authentication set")
-		req.SetBasicAuth(d.username, d.password)
-	}
-	l.Trace().Str("url", req.URL.String()).Msg("Sending request")
-	res, err := d.client.Do(req)
+// serveMetrics writes the gathered metrics in the format negotiated with the scraper, gzipped
+// when the scraper accepts it. Unlike promhttp it adds # UNIT metadata to OpenMetrics output, and
+// sets timestamp on every sample when it isn't zero.
+func (d *Direkt) serveMetrics(w http.ResponseWriter, r *http.Request, l zerolog.Logger, g prometheus.Gatherer, timestamp time.Time) {
+	mfs, err := g.Gather()
 	if err != nil {
-		return nil, err
+		l.Err(err).Msg("Error gathering metrics")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	if res == nil {
-		return nil, nil
+	for _, mf := range mfs {
+		if unit, ok := d.units[mf.GetName()]; ok {
+			mf.Unit = &unit
+		}
+		if !timestamp.IsZero() {
+			ms := timestamp.UnixMilli()
+			for _, m := range mf.Metric {
+				m.TimestampMs = &ms
+			}
+		}
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode == 503 {
-		return nil, errUnitOffline
+	format := expfmt.NegotiateIncludingOpenMetrics(r.Header)
+	w.Header().Set("Content-Type", string(format))
+	var out io.Writer = w
+	if acceptsGzip(r) {
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		defer gz.Close()
+		out = gz
 	}
 
-	if res.StatusCode != 200 {
-		l.Info().Int("status_code", res.StatusCode).Str("request", req.URL.String()).Msg("Non-OK status code returned")
-		return nil, errors.New("non-okay request returned")
+	enc := expfmt.NewEncoder(out, format, expfmt.WithUnit(), expfmt.WithCreatedLines())
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			l.Err(err).Msg("Error encoding metrics")
+			return
+		}
+	}
+	if closer, ok := enc.(expfmt.Closer); ok {
+		if err := closer.Close(); err != nil {
+			l.Err(err).Msg("Error encoding metrics")
+		}
 	}
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+// acceptsGzip reports whether the request accepts a gzip encoded response
+func acceptsGzip(r *http.Request) bool {
+	for _, encoding := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(encoding), ";")
+		if strings.TrimSpace(name) == "gzip" {
+			return strings.ReplaceAll(strings.TrimSpace(params), " ", "") != "q=0"
+		}
 	}
-	l.Trace().Str("url", req.URL.String()).Msg("Finished request, returning body")
-	return body, err
+	return false
 }
 
-type metricGatherer func(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error
+const (
+	RequestSuccess  = "request_success"
+	RequestDuration = "request_duration"
+)
 
-func (d *Direkt) gatherMetrics(ctx context.Context, l zerolog.Logger, metrics []metricGatherer, id string) (*prometheus.Registry, error) {
+var requestMetrics = []metrics.Gauge{
+	{
+		Name:   RequestSuccess,
+		Desc:   "Displays whether or not the request was a success",
+		Labels: []string{},
+	},
+	{
+		Name:   RequestDuration,
+		Unit:   metrics.UnitSeconds,
+		Desc:   "Returns how long the request took to complete in seconds",
+		Labels: []string{},
+	},
+}
+
+type metricGatherer func(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error
+
+func (d *Direkt) gatherMetrics(ctx context.Context, l zerolog.Logger, gatherers []metricGatherer, id string, state *unitState) (*prometheus.Registry, error) {
 	l.Info().Msg("Requesting metrics for Direkt unit")
 	start := time.Now()
-	successGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "request_success",
-		Help: "Displays whether or not the request was a success",
-	})
-	durationGauge := prometheus.NewGauge(prometheus.GaugeOpts{
-		Name: "request_duration_seconds",
-		Help: "Returns how long the request took to complete in seconds",
-	})
+	mtrcs := metrics.NewGaugeMap(requestMetrics, d.opts.metricOptions(FamilyRequest))
+	successGauge := mtrcs[RequestSuccess].WithLabelValues()
+	durationGauge := mtrcs[RequestDuration].WithLabelValues()
 
 	baseRegistry := prometheus.NewRegistry()
-	registry := prometheus.WrapRegistererWith(prometheus.Labels{"serial": id}, baseRegistry)
-	registry.MustRegister(successGauge)
-	registry.MustRegister(durationGauge)
+	registry := prometheus.WrapRegistererWith(d.opts.constLabels(id), baseRegistry)
+	for _, metric := range mtrcs {
+		registry.MustRegister(metric)
+	}
+	opts := d.opts
+	opts.state = state
+	ctx = l.WithContext(ctx)
+	unit := d.client.Unit(id)
+	if err := unit.Discover(ctx); err != nil {
+		l.Debug().Err(err).Msg("Error reading unit links, using default resource paths")
+	}
 	var retErr error
-	for _, metric := range metrics {
-		err := metric(ctx, l, registry, d.doRequest, id)
+	for _, gatherer := range gatherers {
+		err := gatherer(ctx, l, registry, unit, opts)
 		if err != nil {
 			l.Err(err).Msg("Error retrieving metrics")
 			successGauge.Set(0)
-			if errors.Is(err, errUnitOffline) {
+			if errors.Is(err, iss.ErrUnitOffline) {
 				break
 			}
 			retErr = err
@@ -130,16 +440,56 @@ func (d *Direkt) gatherMetrics(ctx context.Context, l zerolog.Logger, metrics []
 	return baseRegistry, retErr
 }
 
+// withSchema swaps gauges in base for the v2 definitions of the same name and appends
+// the v2-only gauges when the v2 schema is selected
+func withSchema(schema Schema, base, v2 []metrics.Gauge) []metrics.Gauge {
+	if schema != SchemaV2 {
+		return base
+	}
+	return withOverrides(base, v2)
+}
+
+// withOverrides swaps gauges in base for the definitions in defs of the same name and appends
+// the remaining gauges of defs
+func withOverrides(base, defs []metrics.Gauge) []metrics.Gauge {
+	overrides := make(map[string]metrics.Gauge, len(defs))
+	for _, g := range defs {
+		overrides[g.Name] = g
+	}
+
+	ret := make([]metrics.Gauge, 0, len(base)+len(defs))
+	for _, g := range base {
+		if o, ok := overrides[g.Name]; ok {
+			g = o
+			delete(overrides, g.Name)
+		}
+		ret = append(ret, g)
+	}
+	for _, g := range defs {
+		if _, ok := overrides[g.Name]; ok {
+			ret = append(ret, g)
+		}
+	}
+	return ret
+}
+
 func validateRequest(r *http.Request) (string, error) {
 	params := r.URL.Query()
 
 	val := params.Get("serial")
-	if val == "" {
-		return "", errors.New("no serial provided")
+	if err := ValidateSerial(val); err != nil {
+		return "", err
 	}
+	return val, nil
+}
 
-	if !strings.HasPrefix(val, "D0") {
-		return "", errors.New("invalid serial provided")
+func ValidateSerial(serial string) error {
+	if serial == "" {
+		return errors.New("no serial provided")
 	}
-	return val, nil
+
+	if !strings.HasPrefix(serial, "D0") {
+		return errors.New("invalid serial provided")
+	}
+	return nil
 }
@@ -0,0 +1,101 @@
+package direkt
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+)
+
+func TestValidateLabels(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  Options
+		valid bool
+	}{
+		{"defaults", Options{}, true},
+		{"legacy names", Options{LegacyNames: true}, true},
+		{"v2 schema", Options{Schema: SchemaV2}, true},
+		{"drop", Options{Labels: map[string]metrics.LabelConfig{FamilyEncoder: {Drop: []string{LabelEncoderName}}}}, true},
+		{"keep", Options{Labels: map[string]metrics.LabelConfig{FamilySystem: {Keep: []string{LabelNetworkInterface}}}}, true},
+		{"unknown family", Options{Labels: map[string]metrics.LabelConfig{"nope": {}}}, false},
+		{"drop state", Options{Labels: map[string]metrics.LabelConfig{FamilySystem: {Drop: []string{metrics.LabelState}}}}, false},
+		{"clashing rename", Options{Labels: map[string]metrics.LabelConfig{FamilyEncoder: {Rename: map[string]string{LabelEncoderName: LabelEncoderIndex}}}}, false},
+		{"request labels", Options{Labels: map[string]metrics.LabelConfig{FamilyRequest: {ExtraLabels: map[string]string{"probe": "direkt"}}}}, true},
+		{"custom metric", Options{CustomMetrics: []CustomMetric{{Name: "uptime", Path: "system/status", Value: "uptime"}}}, true},
+		{"custom request_success", Options{CustomMetrics: []CustomMetric{{Name: RequestSuccess, Path: "system/status"}}}, false},
+		{"custom request_duration", Options{CustomMetrics: []CustomMetric{{Name: RequestDuration, Unit: metrics.UnitSeconds, Path: "system/status"}}}, false},
+		{"legacy custom request_success", Options{LegacyNames: true, CustomMetrics: []CustomMetric{{Name: RequestSuccess, Path: "system/status"}}}, false},
+		{"custom encoder metric", Options{CustomMetrics: []CustomMetric{{Name: MetricEncoderFallbackActive, Path: "system/status"}}}, false},
+		{"duplicate custom metric", Options{CustomMetrics: []CustomMetric{{Name: "uptime", Path: "system/status"}, {Name: "uptime", Type: CustomCounter, Path: "system/status"}}}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.opts.Validate(); (err == nil) != tt.valid {
+			t.Errorf("%s: Validate() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestUnits(t *testing.T) {
+	units := Options{}.units()
+	if got := units["direkt_network_input_bitrate_bits_per_second"]; got != metrics.UnitBitsPerSecond {
+		t.Errorf("unit of direkt_network_input_bitrate_bits_per_second = %q", got)
+	}
+
+	// Legacy names only carry a unit if they end in it
+	units = Options{LegacyNames: true}.units()
+	if _, ok := units["network_input_bitrate"]; ok {
+		t.Error("network_input_bitrate has a unit")
+	}
+	if got := units["network_input_end_to_end_delay_seconds"]; got != metrics.UnitSeconds {
+		t.Errorf("unit of network_input_end_to_end_delay_seconds = %q", got)
+	}
+	for name, unit := range units {
+		if !strings.HasSuffix(name, "_"+unit) {
+			t.Errorf("%s has unit %s", name, unit)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	delay := prometheus.NewGauge(prometheus.GaugeOpts{Name: "direkt_delay_seconds", Help: "Delay"})
+	delay.Set(0.5)
+	registry.MustRegister(delay)
+	d := &Direkt{units: map[string]string{"direkt_delay_seconds": metrics.UnitSeconds}}
+	timestamp := time.Unix(1700000000, 0)
+
+	r := httptest.NewRequest(http.MethodGet, "/probe", nil)
+	r.Header.Set("Accept", "application/openmetrics-text;version=1.0.0")
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	d.serveMetrics(w, r, zerolog.Nop(), registry, timestamp)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# UNIT direkt_delay_seconds seconds\n",
+		"direkt_delay_seconds 0.5 1.7e+09\n",
+		"# EOF\n",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("response lacks %q:\n%s", line, body)
+		}
+	}
+}
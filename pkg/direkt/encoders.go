@@ -2,13 +2,15 @@ package direkt
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
+	neturl "net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
 )
@@ -18,30 +20,65 @@ const (
 	MetricEncoderAudioStatus                              = "encoder_audio_config"
 	MetricEncoderVideoInputStatus                         = "encoder_video_input_status"
 	MetricEncoderAudioInputStatus                         = "encoder_audio_input_status"
-	MetricEncoderTotalBitrate                             = "encoder_total_bitrate_bits"
-	MetricEncoderDestinationBitrate                       = "encoder_basic_destination_bitrate_bits"
+	MetricEncoderTotalBitrate                             = "encoder_total_bitrate"
+	MetricEncoderDestinationBitrate                       = "encoder_basic_destination_bitrate"
 	MetricEncoderBasicDestinationPacketLoss               = "encoder_basic_destination_packet_loss"
 	MetricEncoderBasicDestinationFECPacketLoss            = "encoder_basic_destination_fec_packet_loss"
 	MetricEncoderBasicDestinationFECOverhead              = "encoder_basic_destination_fec_bitrate_overhead"
-	MetricEncoderBasicDestinationUDPSmoothingBuffer       = "encoder_basic_destination_udp_smoothing_buffer_seconds"
-	MetricEncoderBasicDestinationPathLatency              = "encoder_basic_destination_path_latency_seconds"
-	MetricEncoderBasicDestinationPathLatencyHistorical    = "encoder_basic_destination_path_latency_historical_seconds"
+	MetricEncoderBasicDestinationUDPSmoothingBuffer       = "encoder_basic_destination_udp_smoothing_buffer"
+	MetricEncoderBasicDestinationPathLatency              = "encoder_basic_destination_path_latency"
+	MetricEncoderBasicDestinationPathLatencyHistorical    = "encoder_basic_destination_path_latency_historical"
 	MetricEncoderBasicDestinationPathViable               = "encoder_basic_destination_path_viable"
-	MetricEncoderBasicDestinationPathBitrate              = "encoder_basic_destination_path_bitrate_bits"
+	MetricEncoderBasicDestinationPathBitrate              = "encoder_basic_destination_path_bitrate"
 	MetricEncoderBasicDestinationPathPacketLoss           = "encoder_basic_destination_path_packet_loss"
 	MetricEncoderBasicDestinationPathPacketLossHistorical = "encoder_basic_destination_path_packet_loss_historical"
-	MetricEncoderBasicDestinationPathCapacity             = "encoder_basic_destination_path_estimated_capacity_bits"
-	MetricEncoderBasicDestinationPathRedundancy           = "encoder_basic_destination_path_redundancy_bitrate_bits"
+	MetricEncoderBasicDestinationPathCapacity             = "encoder_basic_destination_path_estimated_capacity"
+	MetricEncoderBasicDestinationPathRedundancy           = "encoder_basic_destination_path_redundancy_bitrate"
 	MetricEncoderBasicDestinationFailoverActive           = "encoder_basic_destination_failover_active"
+	MetricEncoderBasicDestinationBondingBitrate           = "encoder_basic_destination_bonding_bitrate"
+	MetricEncoderBasicDestinationCapacity                 = "encoder_basic_destination_estimated_capacity"
+	MetricEncoderBasicDestinationCapacityUtilisation      = "encoder_basic_destination_capacity_utilisation"
+	MetricEncoderBasicDestinationEstimateIsMax            = "encoder_basic_destination_estimate_is_max"
+	MetricEncoderBasicDestinationBondingDestinations      = "encoder_basic_destination_bonding_destinations"
+	MetricEncoderBasicDestinationPacketsLate              = "encoder_basic_destination_packets_late"
+	MetricEncoderBasicDestinationPathPacketsLate          = "encoder_basic_destination_path_packets_late"
+	MetricEncoderBasicDestinationPathPacketsLateHistory   = "encoder_basic_destination_path_packets_late_historical"
+	MetricEncoderBasicDestinationPathEstimateIsMax        = "encoder_basic_destination_path_estimate_is_max"
+	MetricEncoderVideoInputInfo                           = "encoder_video_input_info"
+	MetricEncoderVideoInputWidth                          = "encoder_video_input_width"
+	MetricEncoderVideoInputHeight                         = "encoder_video_input_height"
+	MetricEncoderVideoInputFramerate                      = "encoder_video_input_framerate"
+	MetricEncoderVideoConfigInfo                          = "encoder_video_config_info"
+	MetricEncoderVideoTargetBitrate                       = "encoder_video_target_bitrate"
+	MetricEncoderVideoWidth                               = "encoder_video_width"
+	MetricEncoderVideoHeight                              = "encoder_video_height"
+	MetricEncoderVideoFramerate                           = "encoder_video_framerate"
+	MetricEncoderRTMPDestinationConnected                 = "encoder_rtmp_destination_connected"
+	MetricEncoderRTMPDestinationBitrate                   = "encoder_rtmp_destination_bitrate"
+	MetricEncoderRTMPDestinationReconnects                = "encoder_rtmp_destination_reconnects"
+	MetricEncoderSourceInfo                               = "encoder_source_info"
+	MetricEncoderFallbackActive                           = "encoder_fallback_active"
+	MetricEncoderFallbackInfo                             = "encoder_fallback_info"
+	MetricEncoderVideoPerformanceModeInfo                 = "encoder_video_performance_mode_info"
+	MetricEncoderVideoPerformanceModeMismatch             = "encoder_video_performance_mode_mismatch"
+	MetricEncoderVideoBitrateBuffer                       = "encoder_video_bitrate_buffer"
+	MetricEncoderVideoAdaptiveBitrate                     = "encoder_video_adaptive_bitrate"
+	MetricEncoderAudioBitrate                             = "encoder_audio_bitrate"
+	MetricEncoderAudioAdaptiveBitrate                     = "encoder_audio_adaptive_bitrate"
 )
 
 // Global label names
 const (
-	LabelEncoderIndex       = "encoder_index"
-	LabelEncoderName        = "encoder_name"
-	LabelDestination        = "destination"
-	LabelDestinationIndex   = "destination_index"
-	LabelBondingDestination = "bonding_destination"
+	LabelEncoderIndex        = "encoder_index"
+	LabelEncoderName         = "encoder_name"
+	LabelDestination         = "destination"
+	LabelDestinationIndex    = "destination_index"
+	LabelBondingDestination  = "bonding_destination"
+	LabelRTMPHost            = "rtmp_host"
+	LabelSource              = "source"
+	LabelProgramID           = "program_id"
+	LabelFallbackType        = "fallback_type"
+	LabelFallbackDescription = "fallback_description"
 
 	// Video format labels
 	LabelInterlaced        = "interlaced"
@@ -91,6 +128,70 @@ var encoderMetrics = []metrics.Gauge{
 			LabelForcedAspect,
 		},
 	},
+	{
+		Name: MetricEncoderSourceInfo,
+		Desc: "Video source the encoder is configured to use, e.g. video_inputs/0. Value is always 1.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelSource,
+			LabelProgramID,
+		},
+	},
+	{
+		Name: MetricEncoderFallbackActive,
+		Desc: "1 if the encoder is sending its fallback because the configured source is unavailable, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelFallbackType,
+		},
+	},
+	{
+		Name: MetricEncoderFallbackInfo,
+		Desc: "Description of the fallback the encoder sends when its source is unavailable. Value is always 1.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelFallbackDescription,
+		},
+	},
+	{
+		Name: MetricEncoderVideoPerformanceModeInfo,
+		Desc: "Running, configured and default video encoder performance modes as labels. Value is always 1.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelPerformanceMode,
+			LabelConfiguredPerformanceMode,
+			LabelDefaultPerformanceMode,
+		},
+	},
+	{
+		Name: MetricEncoderVideoPerformanceModeMismatch,
+		Desc: "1 if the video encoder runs in a different performance mode than configured, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoBitrateBuffer,
+		Unit: metrics.UnitSeconds,
+		Desc: "Rate control buffer of the video encoder in seconds.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoAdaptiveBitrate,
+		Desc: "1 if adaptive bitrate is enabled for the video encoder, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
 	{
 		Name: MetricEncoderAudioInputStatus,
 		Desc: "Audio encoding status. Value is 1 if source is available, 0 otherwise. Audio properties are in labels.",
@@ -139,16 +240,39 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderTotalBitrate,
-		Desc: "Total encoder bitrate in bits per second (sum of video and audio streams).",
+		Name: MetricEncoderAudioBitrate,
+		Unit: metrics.UnitBitsPerSecond,
+		Desc: "Configured audio encoder bitrate in bits per second.",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
+			LabelAudioIndex,
 		},
 	},
 	{
-		Name: MetricEncoderDestinationBitrate,
-		Desc: "Output bitrate to a destination in bits per second.",
+		Name: MetricEncoderAudioAdaptiveBitrate,
+		Desc: "1 if adaptive bitrate is enabled for the audio encoder, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelAudioIndex,
+		},
+	},
+	{
+		Name:   MetricEncoderTotalBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_total_bitrate_bits",
+		Desc:   "Total encoder bitrate in bits per second (sum of video and audio streams).",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name:   MetricEncoderDestinationBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_bitrate_bits",
+		Desc:   "Output bitrate to a destination in bits per second.",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -157,8 +281,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPacketLoss,
-		Desc: "Overall packet loss ratio for a destination (0-1).",
+		Name:   MetricEncoderBasicDestinationPacketLoss,
+		Unit:   metrics.UnitRatio,
+		Legacy: "encoder_basic_destination_packet_loss",
+		Desc:   "Overall packet loss ratio for a destination (0-1).",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -167,8 +293,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationFECPacketLoss,
-		Desc: "FEC packet loss for a destination (fractional).",
+		Name:   MetricEncoderBasicDestinationFECPacketLoss,
+		Unit:   metrics.UnitRatio,
+		Legacy: "encoder_basic_destination_fec_packet_loss",
+		Desc:   "FEC packet loss for a destination (fractional).",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -177,8 +305,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationFECOverhead,
-		Desc: "FEC bitrate overhead ratio for a destination (fractional).",
+		Name:   MetricEncoderBasicDestinationFECOverhead,
+		Unit:   metrics.UnitRatio,
+		Legacy: "encoder_basic_destination_fec_bitrate_overhead",
+		Desc:   "FEC bitrate overhead ratio for a destination (fractional).",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -188,6 +318,7 @@ var encoderMetrics = []metrics.Gauge{
 	},
 	{
 		Name: MetricEncoderBasicDestinationUDPSmoothingBuffer,
+		Unit: metrics.UnitSeconds,
 		Desc: "UDP smoothing buffer duration for a destination in seconds.",
 		Labels: []string{
 			LabelEncoderIndex,
@@ -198,6 +329,7 @@ var encoderMetrics = []metrics.Gauge{
 	},
 	{
 		Name: MetricEncoderBasicDestinationPathLatency,
+		Unit: metrics.UnitSeconds,
 		Desc: "Current latency in seconds for a destination path.",
 		Labels: []string{
 			LabelEncoderIndex,
@@ -210,6 +342,7 @@ var encoderMetrics = []metrics.Gauge{
 	},
 	{
 		Name: MetricEncoderBasicDestinationPathLatencyHistorical,
+		Unit: metrics.UnitSeconds,
 		Desc: "Historical average latency in seconds for a destination path.",
 		Labels: []string{
 			LabelEncoderIndex,
@@ -233,8 +366,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPathBitrate,
-		Desc: "Current bitrate on a specific destination path (bits per second).",
+		Name:   MetricEncoderBasicDestinationPathBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_path_bitrate_bits",
+		Desc:   "Current bitrate on a specific destination path (bits per second).",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -245,8 +380,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPathPacketLoss,
-		Desc: "Current packet loss ratio (0-1) on a destination path.",
+		Name:   MetricEncoderBasicDestinationPathPacketLoss,
+		Unit:   metrics.UnitRatio,
+		Legacy: "encoder_basic_destination_path_packet_loss",
+		Desc:   "Current packet loss ratio (0-1) on a destination path.",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -257,8 +394,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPathPacketLossHistorical,
-		Desc: "Historical average packet loss ratio (0-1) on a destination path.",
+		Name:   MetricEncoderBasicDestinationPathPacketLossHistorical,
+		Unit:   metrics.UnitRatio,
+		Legacy: "encoder_basic_destination_path_packet_loss_historical",
+		Desc:   "Historical average packet loss ratio (0-1) on a destination path.",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -269,8 +408,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPathCapacity,
-		Desc: "Estimated capacity in bits per second for a destination path.",
+		Name:   MetricEncoderBasicDestinationPathCapacity,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_path_estimated_capacity_bits",
+		Desc:   "Estimated capacity in bits per second for a destination path.",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -281,8 +422,10 @@ var encoderMetrics = []metrics.Gauge{
 		},
 	},
 	{
-		Name: MetricEncoderBasicDestinationPathRedundancy,
-		Desc: "Configured redundancy bitrate for a destination path (bits per second).",
+		Name:   MetricEncoderBasicDestinationPathRedundancy,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_path_redundancy_bitrate_bits",
+		Desc:   "Configured redundancy bitrate for a destination path (bits per second).",
 		Labels: []string{
 			LabelEncoderIndex,
 			LabelEncoderName,
@@ -302,64 +445,478 @@ var encoderMetrics = []metrics.Gauge{
 			LabelDestinationIndex,
 		},
 	},
+	{
+		Name:   MetricEncoderBasicDestinationBondingBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_bonding_bitrate_bits",
+		Desc:   "Bonded bitrate to a destination in bits per second.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:   MetricEncoderBasicDestinationCapacity,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_basic_destination_estimated_capacity_bits",
+		Desc:   "Estimated bonded capacity in bits per second for a destination.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationCapacityUtilisation,
+		Unit: metrics.UnitRatio,
+		Desc: "Ratio of bonded bitrate to estimated capacity for a destination (0-1). Values close to 1 leave no headroom for a higher bitrate.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationEstimateIsMax,
+		Desc: "1 if the destination capacity estimate is capped at the maximum the unit will probe, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationBondingDestinations,
+		Desc: "Number of bonding destinations configured for a destination.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:       MetricEncoderBasicDestinationPacketsLate,
+		LegacyOnly: true,
+		Desc:       "Number of late packets for a destination, summed over all paths.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:       MetricEncoderBasicDestinationPathPacketsLate,
+		LegacyOnly: true,
+		Desc:       "Number of late packets on a destination path.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationPathPacketsLateHistory,
+		Desc: "Historical average of late packets on a destination path.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationPathEstimateIsMax,
+		Desc: "1 if the destination path capacity estimate is capped at the maximum the unit will probe, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+	},
+	{
+		Name: MetricEncoderRTMPDestinationConnected,
+		Desc: "1 if the RTMP destination is connected, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelRTMPHost,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:   MetricEncoderRTMPDestinationBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_rtmp_destination_bitrate_bits",
+		Desc:   "Output bitrate to an RTMP destination in bits per second.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelRTMPHost,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:       MetricEncoderRTMPDestinationReconnects,
+		LegacyOnly: true,
+		Desc:       "Number of times the RTMP destination has reconnected.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelRTMPHost,
+			LabelDestinationIndex,
+		},
+	},
 }
 
-func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error {
-	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/encoders", url, unitEndpoint, id), nil)
-	if err != nil {
-		return err
-	}
+// Byte counters integrated from bitrates when the unit is polled
+const (
+	MetricEncoderBasicDestinationSent     = "encoder_basic_destination_sent"
+	MetricEncoderBasicDestinationPathSent = "encoder_basic_destination_path_sent"
+	MetricEncoderRTMPDestinationSent      = "encoder_rtmp_destination_sent"
+)
 
-	res, err := doReq(l, request)
-	if err != nil {
-		return err
-	}
-	var encoders models.EncodersResponse
-	err = json.Unmarshal(res, &encoders)
+var encoderCounters = []metrics.Counter{
+	{
+		Name: MetricEncoderBasicDestinationSent,
+		Unit: metrics.UnitBytes,
+		Desc: "Bytes sent to a destination, integrated from the destination bitrate between polls.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name: MetricEncoderBasicDestinationPathSent,
+		Unit: metrics.UnitBytes,
+		Desc: "Bytes sent on a destination path, integrated from the path bitrate between polls.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+	},
+	{
+		Name: MetricEncoderRTMPDestinationSent,
+		Unit: metrics.UnitBytes,
+		Desc: "Bytes sent to an RTMP destination, integrated from the destination bitrate between polls.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelRTMPHost,
+			LabelDestinationIndex,
+		},
+	},
+}
+
+// Counters of cumulative values reported by the unit. They replace gauges of the same name, so
+// legacy names keep the namespace to tell them apart.
+var encoderReportedCounters = []metrics.Counter{
+	{
+		Name:   MetricEncoderBasicDestinationPacketsLate,
+		Legacy: "direkt_" + MetricEncoderBasicDestinationPacketsLate,
+		Desc:   "Number of late packets for a destination, summed over all paths.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelDestination,
+			LabelDestinationIndex,
+		},
+	},
+	{
+		Name:   MetricEncoderBasicDestinationPathPacketsLate,
+		Legacy: "direkt_" + MetricEncoderBasicDestinationPathPacketsLate,
+		Desc:   "Number of late packets on a destination path.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+	},
+	{
+		Name:   MetricEncoderRTMPDestinationReconnects,
+		Legacy: "direkt_" + MetricEncoderRTMPDestinationReconnects,
+		Desc:   "Number of times the RTMP destination has reconnected.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelRTMPHost,
+			LabelDestinationIndex,
+		},
+	},
+}
+
+// Histograms of path samples accumulated across polls
+const (
+	MetricEncoderBondingPathLatency    = "encoder_bonding_path_latency"
+	MetricEncoderBondingPathPacketLoss = "encoder_bonding_path_packet_loss"
+)
+
+var encoderHistograms = []metrics.Histogram{
+	{
+		Name: MetricEncoderBondingPathLatency,
+		Unit: metrics.UnitSeconds,
+		Desc: "Distribution of destination path latency in seconds, sampled on every poll.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+		Buckets: []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+	},
+	{
+		Name: MetricEncoderBondingPathPacketLoss,
+		Unit: metrics.UnitRatio,
+		Desc: "Distribution of destination path packet loss ratio (0-1), sampled on every poll.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBondingDestination,
+			LabelDestination,
+			LabelDestinationIndex,
+			LabelNetworkInterface,
+		},
+		Buckets: []float64{0.001, 0.005, 0.01, 0.02, 0.05, 0.1, 0.25, 0.5, 1},
+	},
+}
+
+// encoderMetricsV2 replaces the label-heavy video gauges of encoderMetrics when the v2 schema is selected
+var encoderMetricsV2 = []metrics.Gauge{
+	{
+		Name: MetricEncoderVideoInputStatus,
+		Desc: "Video input status. Value is 1 if source is available, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoInputInfo,
+		Desc: "Video input format properties as labels. Value is always 1.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelBitDepth,
+			LabelInterlaced,
+			LabelTopFieldFirst,
+			LabelChromaSubsampling,
+			LabelDisplayAspect,
+			LabelPixelAspect,
+			LabelForcedAspect,
+		},
+	},
+	{
+		Name: MetricEncoderVideoInputWidth,
+		Unit: metrics.UnitPixels,
+		Desc: "Video input width in pixels.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoInputHeight,
+		Unit: metrics.UnitPixels,
+		Desc: "Video input height in pixels.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoInputFramerate,
+		Desc: "Video input framerate in frames per second.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoStatus,
+		Desc: "Video encoder status. Value is 1 if encoder is active, 0 otherwise.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoConfigInfo,
+		Desc: "Video encoder codec and format properties as labels. Value is always 1.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+			LabelCodec,
+			LabelProfile,
+			LabelCodecLevel,
+			LabelBitDepth,
+			LabelInterlaced,
+			LabelTopFieldFirst,
+			LabelChromaSubsampling,
+			LabelDisplayAspect,
+			LabelPixelAspect,
+			LabelForcedAspect,
+		},
+	},
+	{
+		Name:   MetricEncoderVideoTargetBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "encoder_video_target_bitrate_bits",
+		Desc:   "Configured video encoder bitrate in bits per second.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoWidth,
+		Unit: metrics.UnitPixels,
+		Desc: "Encoded video width in pixels.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoHeight,
+		Unit: metrics.UnitPixels,
+		Desc: "Encoded video height in pixels.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+	{
+		Name: MetricEncoderVideoFramerate,
+		Desc: "Encoded video framerate in frames per second.",
+		Labels: []string{
+			LabelEncoderIndex,
+			LabelEncoderName,
+		},
+	},
+}
+
+func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	encoders, err := unit.ListEncoders(ctx)
 	if err != nil {
 		return err
 	}
 
-	mtrcs := metrics.NewGaugeMap(encoderMetrics)
+	mtrcs := metrics.NewGaugeMap(withSchema(opts.Schema, encoderMetrics, encoderMetricsV2), opts.metricOptions(FamilyEncoder))
 	for _, metric := range mtrcs {
 		registry.MustRegister(metric)
 		metric.Reset()
 	}
+	counters := metrics.NewCounterValueMap(encoderReportedCounters, opts.metricOptions(FamilyEncoder))
+	for _, metric := range counters {
+		registry.MustRegister(metric)
+	}
+	integrators := opts.state.registerIntegrators(registry, FamilyEncoder)
+	histograms := opts.state.registerHistograms(registry, FamilyEncoder)
+	now := time.Now()
+	// Series are only pruned when every encoder was read, so a failed request doesn't discard
+	// what was accumulated for the encoder
+	complete := true
 
 	for _, encoder := range encoders.Encoders {
-		request, err = http.NewRequest("GET", fmt.Sprintf("%s%s%s/encoders/%d/status", url, unitEndpoint, id, encoder.Index), nil)
-		if err != nil {
-			l.Err(err).Int("encoder_index", encoder.Index).Msg("Error creating encoder request, skipping")
-			continue
-		}
-		res, err := doReq(l, request)
+		e, err := unit.GetEncoderStatus(ctx, encoder)
 		if err != nil {
 			l.Err(err).Int("encoder_index", encoder.Index).Msg("Error getting encoder metrics, skipping")
-			continue
-		}
-		var e models.EncoderStatus
-		err = json.Unmarshal(res, &e)
-		if err != nil {
-			l.Err(err).Int("encoder_index", encoder.Index).Msg("Error decoding encoder status response, skipping")
+			complete = false
 			continue
 		}
 
 		encoderIdx := strconv.Itoa(encoder.Index)
 
-		mtrcs[MetricEncoderVideoInputStatus].WithLabelValues(
+		if opts.Schema == SchemaV2 {
+			format := e.VideoSource.Video.Format
+			mtrcs[MetricEncoderVideoInputStatus].WithLabelValues(encoderIdx, e.Description).Set(metrics.BoolToFloat64(e.VideoSource.Available))
+			mtrcs[MetricEncoderVideoInputInfo].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				strconv.Itoa(format.BitDepth),
+				metrics.BoolToString(format.Interlaced),
+				metrics.BoolToString(format.TopFieldFirst),
+				format.ChromaSubsampling,
+				format.DisplayAspect,
+				format.PixelAspect,
+				metrics.BoolToString(format.ForcedAspect),
+			).Set(1)
+			mtrcs[MetricEncoderVideoInputWidth].WithLabelValues(encoderIdx, e.Description).Set(float64(format.Width))
+			mtrcs[MetricEncoderVideoInputHeight].WithLabelValues(encoderIdx, e.Description).Set(float64(format.Height))
+			mtrcs[MetricEncoderVideoInputFramerate].WithLabelValues(encoderIdx, e.Description).Set(format.Framerate)
+		} else {
+			mtrcs[MetricEncoderVideoInputStatus].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				fmt.Sprintf("%.2f", e.VideoSource.Video.Format.Framerate),
+				strconv.Itoa(e.VideoSource.Video.Format.Width),
+				strconv.Itoa(e.VideoSource.Video.Format.Height),
+				strconv.Itoa(e.VideoSource.Video.Format.BitDepth),
+				metrics.BoolToString(e.VideoSource.Video.Format.Interlaced),
+				metrics.BoolToString(e.VideoSource.Video.Format.TopFieldFirst),
+				e.VideoSource.Video.Format.ChromaSubsampling,
+				e.VideoSource.Video.Format.DisplayAspect,
+				e.VideoSource.Video.Format.PixelAspect,
+				metrics.BoolToString(e.VideoSource.Video.Format.ForcedAspect),
+			).Set(metrics.BoolToFloat64(e.VideoSource.Available))
+		}
+
+		opts.state.addThumbnail(ThumbnailEncoder, encoderIdx, e.Description, e.VideoSource.Thumbnail)
+		mtrcs[MetricEncoderSourceInfo].WithLabelValues(
 			encoderIdx,
 			e.Description,
-			fmt.Sprintf("%.2f", e.VideoSource.Video.Format.Framerate),
-			strconv.Itoa(e.VideoSource.Video.Format.Width),
-			strconv.Itoa(e.VideoSource.Video.Format.Height),
-			strconv.Itoa(e.VideoSource.Video.Format.BitDepth),
-			metrics.BoolToString(e.VideoSource.Video.Format.Interlaced),
-			metrics.BoolToString(e.VideoSource.Video.Format.TopFieldFirst),
-			e.VideoSource.Video.Format.ChromaSubsampling,
-			e.VideoSource.Video.Format.DisplayAspect,
-			e.VideoSource.Video.Format.PixelAspect,
-			metrics.BoolToString(e.VideoSource.Video.Format.ForcedAspect),
-		).Set(metrics.BoolToFloat64(e.VideoSource.Available))
+			simplifySource(e.VideoSource.Source),
+			strconv.Itoa(e.VideoSource.ProgramID),
+		).Set(1)
+		mtrcs[MetricEncoderFallbackActive].WithLabelValues(
+			encoderIdx,
+			e.Description,
+			e.VideoSource.FallbackType,
+		).Set(metrics.BoolToFloat64(fallbackActive(e.VideoSource)))
+		mtrcs[MetricEncoderFallbackInfo].WithLabelValues(
+			encoderIdx,
+			e.Description,
+			e.VideoSource.FallbackDescription,
+		).Set(1)
+
+		codec := e.Encoding.Video.Codec
+		mtrcs[MetricEncoderVideoPerformanceModeInfo].WithLabelValues(
+			encoderIdx,
+			e.Description,
+			codec.PerformanceMode,
+			codec.ConfiguredPerformanceMode,
+			codec.DefaultPerformanceMode,
+		).Set(1)
+		mtrcs[MetricEncoderVideoPerformanceModeMismatch].WithLabelValues(encoderIdx, e.Description).Set(metrics.BoolToFloat64(
+			codec.ConfiguredPerformanceMode != "" && codec.PerformanceMode != codec.ConfiguredPerformanceMode,
+		))
+		mtrcs[MetricEncoderVideoBitrateBuffer].WithLabelValues(encoderIdx, e.Description).Set(codec.BitrateBuffer)
+		mtrcs[MetricEncoderVideoAdaptiveBitrate].WithLabelValues(encoderIdx, e.Description).Set(metrics.BoolToFloat64(codec.AdaptiveBitrate))
 
 		for i, audio := range e.VideoSource.Audio {
 			mtrcs[MetricEncoderAudioInputStatus].WithLabelValues(
@@ -372,24 +929,47 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 			).Set(metrics.BoolToFloat64(e.VideoSource.Available))
 		}
 
-		mtrcs[MetricEncoderVideoStatus].WithLabelValues(
-			encoderIdx,
-			e.Description,
-			e.Encoding.Video.Codec.Name,
-			e.Encoding.Video.Codec.Profile,
-			e.Encoding.Video.Codec.Level,
-			strconv.Itoa(e.Encoding.Video.Codec.Bitrate),
-			fmt.Sprintf("%.2f", e.Encoding.Video.Format.Framerate),
-			strconv.Itoa(e.Encoding.Video.Format.Width),
-			strconv.Itoa(e.Encoding.Video.Format.Height),
-			strconv.Itoa(e.Encoding.Video.Format.BitDepth),
-			metrics.BoolToString(e.Encoding.Video.Format.Interlaced),
-			metrics.BoolToString(e.Encoding.Video.Format.TopFieldFirst),
-			e.Encoding.Video.Format.ChromaSubsampling,
-			e.Encoding.Video.Format.DisplayAspect,
-			e.Encoding.Video.Format.PixelAspect,
-			metrics.BoolToString(e.Encoding.Video.Format.ForcedAspect),
-		).Set(metrics.BoolToFloat64(e.Active))
+		if opts.Schema == SchemaV2 {
+			format := e.Encoding.Video.Format
+			mtrcs[MetricEncoderVideoStatus].WithLabelValues(encoderIdx, e.Description).Set(metrics.BoolToFloat64(e.Active))
+			mtrcs[MetricEncoderVideoConfigInfo].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				codec.Name,
+				codec.Profile,
+				codec.Level,
+				strconv.Itoa(format.BitDepth),
+				metrics.BoolToString(format.Interlaced),
+				metrics.BoolToString(format.TopFieldFirst),
+				format.ChromaSubsampling,
+				format.DisplayAspect,
+				format.PixelAspect,
+				metrics.BoolToString(format.ForcedAspect),
+			).Set(1)
+			mtrcs[MetricEncoderVideoTargetBitrate].WithLabelValues(encoderIdx, e.Description).Set(float64(codec.Bitrate))
+			mtrcs[MetricEncoderVideoWidth].WithLabelValues(encoderIdx, e.Description).Set(float64(format.Width))
+			mtrcs[MetricEncoderVideoHeight].WithLabelValues(encoderIdx, e.Description).Set(float64(format.Height))
+			mtrcs[MetricEncoderVideoFramerate].WithLabelValues(encoderIdx, e.Description).Set(format.Framerate)
+		} else {
+			mtrcs[MetricEncoderVideoStatus].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				e.Encoding.Video.Codec.Name,
+				e.Encoding.Video.Codec.Profile,
+				e.Encoding.Video.Codec.Level,
+				strconv.Itoa(e.Encoding.Video.Codec.Bitrate),
+				fmt.Sprintf("%.2f", e.Encoding.Video.Format.Framerate),
+				strconv.Itoa(e.Encoding.Video.Format.Width),
+				strconv.Itoa(e.Encoding.Video.Format.Height),
+				strconv.Itoa(e.Encoding.Video.Format.BitDepth),
+				metrics.BoolToString(e.Encoding.Video.Format.Interlaced),
+				metrics.BoolToString(e.Encoding.Video.Format.TopFieldFirst),
+				e.Encoding.Video.Format.ChromaSubsampling,
+				e.Encoding.Video.Format.DisplayAspect,
+				e.Encoding.Video.Format.PixelAspect,
+				metrics.BoolToString(e.Encoding.Video.Format.ForcedAspect),
+			).Set(metrics.BoolToFloat64(e.Active))
+		}
 
 		for i, audio := range e.Encoding.Audio {
 			mtrcs[MetricEncoderAudioStatus].WithLabelValues(
@@ -401,6 +981,8 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 				strconv.Itoa(audio.Format.SampleRate),
 				strconv.Itoa(audio.Format.Channels),
 			).Set(metrics.BoolToFloat64(e.Active))
+			mtrcs[MetricEncoderAudioBitrate].WithLabelValues(encoderIdx, e.Description, strconv.Itoa(i)).Set(float64(audio.Codec.Bitrate))
+			mtrcs[MetricEncoderAudioAdaptiveBitrate].WithLabelValues(encoderIdx, e.Description, strconv.Itoa(i)).Set(metrics.BoolToFloat64(audio.Codec.AdaptiveBitrate))
 		}
 
 		mtrcs[MetricEncoderTotalBitrate].WithLabelValues(
@@ -417,6 +999,17 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 				destinationIdx,
 			).Set(basic.Bitrate)
 
+			if integrators != nil {
+				integrators[MetricEncoderBasicDestinationSent].Observe(
+					now,
+					basic.Bitrate/8,
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					destinationIdx,
+				)
+			}
+
 			mtrcs[MetricEncoderBasicDestinationPacketLoss].WithLabelValues(
 				encoderIdx,
 				e.Description,
@@ -452,6 +1045,63 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 				destinationIdx,
 			).Set(metrics.BoolToFloat64(basic.Bonding.FailoverActive))
 
+			mtrcs[MetricEncoderBasicDestinationBondingBitrate].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				basic.Bonding.Destination,
+				destinationIdx,
+			).Set(basic.Bonding.Bitrate)
+
+			mtrcs[MetricEncoderBasicDestinationCapacity].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				basic.Bonding.Destination,
+				destinationIdx,
+			).Set(basic.Bonding.EstimatedCapacity)
+
+			if basic.Bonding.EstimatedCapacity > 0 {
+				mtrcs[MetricEncoderBasicDestinationCapacityUtilisation].WithLabelValues(
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					destinationIdx,
+				).Set(basic.Bonding.Bitrate / basic.Bonding.EstimatedCapacity)
+			}
+
+			mtrcs[MetricEncoderBasicDestinationEstimateIsMax].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				basic.Bonding.Destination,
+				destinationIdx,
+			).Set(metrics.BoolToFloat64(basic.Bonding.EstimateIsMax))
+
+			mtrcs[MetricEncoderBasicDestinationBondingDestinations].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				basic.Bonding.Destination,
+				destinationIdx,
+			).Set(float64(len(basic.Bonding.Destinations)))
+
+			var packetsLate int
+			for _, path := range basic.Bonding.Paths {
+				packetsLate += path.PacketLate
+			}
+			counters[MetricEncoderBasicDestinationPacketsLate].Set(
+				float64(packetsLate),
+				encoderIdx,
+				e.Description,
+				basic.Bonding.Destination,
+				destinationIdx,
+			)
+			if opts.LegacyNames {
+				mtrcs[MetricEncoderBasicDestinationPacketsLate].WithLabelValues(
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					destinationIdx,
+				).Set(float64(packetsLate))
+			}
+
 			for _, path := range basic.Bonding.Paths {
 				mtrcs[MetricEncoderBasicDestinationPathLatency].WithLabelValues(
 					encoderIdx,
@@ -462,6 +1112,19 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 					simplifyNetworkInterface(path.NetworkInterface),
 				).Set(path.Latency)
 
+				if histograms != nil {
+					histograms[MetricEncoderBondingPathLatency].Observe(
+						now,
+						path.Latency,
+						encoderIdx,
+						e.Description,
+						basic.Bonding.Destination,
+						path.Destination,
+						destinationIdx,
+						simplifyNetworkInterface(path.NetworkInterface),
+					)
+				}
+
 				mtrcs[MetricEncoderBasicDestinationPathLatencyHistorical].WithLabelValues(
 					encoderIdx,
 					e.Description,
@@ -489,6 +1152,19 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 					simplifyNetworkInterface(path.NetworkInterface),
 				).Set(path.Bitrate)
 
+				if integrators != nil {
+					integrators[MetricEncoderBasicDestinationPathSent].Observe(
+						now,
+						path.Bitrate/8,
+						encoderIdx,
+						e.Description,
+						basic.Bonding.Destination,
+						path.Destination,
+						destinationIdx,
+						simplifyNetworkInterface(path.NetworkInterface),
+					)
+				}
+
 				mtrcs[MetricEncoderBasicDestinationPathPacketLoss].WithLabelValues(
 					encoderIdx,
 					e.Description,
@@ -498,6 +1174,19 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 					simplifyNetworkInterface(path.NetworkInterface),
 				).Set(path.PacketLoss)
 
+				if histograms != nil {
+					histograms[MetricEncoderBondingPathPacketLoss].Observe(
+						now,
+						path.PacketLoss,
+						encoderIdx,
+						e.Description,
+						basic.Bonding.Destination,
+						path.Destination,
+						destinationIdx,
+						simplifyNetworkInterface(path.NetworkInterface),
+					)
+				}
+
 				mtrcs[MetricEncoderBasicDestinationPathPacketLossHistorical].WithLabelValues(
 					encoderIdx,
 					e.Description,
@@ -524,9 +1213,125 @@ func encoders(ctx context.Context, l zerolog.Logger, registry prometheus.Registe
 					destinationIdx,
 					simplifyNetworkInterface(path.NetworkInterface),
 				).Set(path.RedundancyBitrate)
+
+				counters[MetricEncoderBasicDestinationPathPacketsLate].Set(
+					float64(path.PacketLate),
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					path.Destination,
+					destinationIdx,
+					simplifyNetworkInterface(path.NetworkInterface),
+				)
+				if opts.LegacyNames {
+					mtrcs[MetricEncoderBasicDestinationPathPacketsLate].WithLabelValues(
+						encoderIdx,
+						e.Description,
+						basic.Bonding.Destination,
+						path.Destination,
+						destinationIdx,
+						simplifyNetworkInterface(path.NetworkInterface),
+					).Set(float64(path.PacketLate))
+				}
+
+				mtrcs[MetricEncoderBasicDestinationPathPacketsLateHistory].WithLabelValues(
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					path.Destination,
+					destinationIdx,
+					simplifyNetworkInterface(path.NetworkInterface),
+				).Set(path.PacketLateHistory)
+
+				mtrcs[MetricEncoderBasicDestinationPathEstimateIsMax].WithLabelValues(
+					encoderIdx,
+					e.Description,
+					basic.Bonding.Destination,
+					path.Destination,
+					destinationIdx,
+					simplifyNetworkInterface(path.NetworkInterface),
+				).Set(metrics.BoolToFloat64(path.EstimateIsMax))
 			}
 		}
 
+		for i, rtmp := range e.Destinations.RTMP {
+			destinationIdx := strconv.Itoa(i)
+			host := rtmpHost(rtmp.URL)
+			mtrcs[MetricEncoderRTMPDestinationConnected].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				host,
+				destinationIdx,
+			).Set(metrics.BoolToFloat64(rtmp.Connected))
+
+			mtrcs[MetricEncoderRTMPDestinationBitrate].WithLabelValues(
+				encoderIdx,
+				e.Description,
+				host,
+				destinationIdx,
+			).Set(rtmp.Bitrate)
+
+			if integrators != nil {
+				integrators[MetricEncoderRTMPDestinationSent].Observe(
+					now,
+					rtmp.Bitrate/8,
+					encoderIdx,
+					e.Description,
+					host,
+					destinationIdx,
+				)
+			}
+
+			counters[MetricEncoderRTMPDestinationReconnects].Set(
+				float64(rtmp.Reconnects),
+				encoderIdx,
+				e.Description,
+				host,
+				destinationIdx,
+			)
+			if opts.LegacyNames {
+				mtrcs[MetricEncoderRTMPDestinationReconnects].WithLabelValues(
+					encoderIdx,
+					e.Description,
+					host,
+					destinationIdx,
+				).Set(float64(rtmp.Reconnects))
+			}
+		}
+	}
+	if complete {
+		for _, integrator := range integrators {
+			integrator.Prune(now)
+		}
+		for _, histogram := range histograms {
+			histogram.Prune(now)
+		}
 	}
 	return err
 }
+
+// rtmpHost extracts "a.rtmp.youtube.com" out of "rtmp://a.rtmp.youtube.com/live2/<stream key>",
+// so the stream key never ends up in a label
+func rtmpHost(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// simplifySource extracts video_inputs/0 out of "/api/v1/units/D02018/video_inputs/0"
+func simplifySource(fullPath string) string {
+	parts := strings.SplitN(fullPath, "/", 6)
+	if len(parts) < 6 {
+		return fullPath
+	}
+
+	return parts[5]
+}
+
+// fallbackActive reports whether the fallback of a video source is being sent, which is the
+// case when a fallback is configured and the source itself is unavailable
+func fallbackActive(source models.VideoSource) bool {
+	return !source.Available && source.FallbackType != "" && source.FallbackType != "none"
+}
@@ -2,43 +2,50 @@ package direkt
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
+	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
-	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
 )
 
 const (
-	InterfaceRxBitrate             = "interface_rx_bitrate_bytes_per_second"
-	InterfaceTxBitrate             = "interface_tx_bitrate_bytes_per_second"
-	InterfaceLinkSpeed             = "interface_link_speed_bits_per_second"
+	InterfaceRxBitrate             = "interface_rx_bitrate"
+	InterfaceTxBitrate             = "interface_tx_bitrate"
+	InterfaceLinkSpeed             = "interface_link_speed"
 	InterfaceInternetAccess        = "interface_internet_access"
 	InterfaceTestingInternetAccess = "interface_testing_internet_access"
+	InterfaceInfo                  = "interface_info"
+	InterfaceLinkUp                = "interface_link_up"
+	InterfaceDuplex                = "interface_duplex"
 )
 
 const (
 	LabelInterfaceMAC     = "interface_mac"
 	LabelIPAddress        = "ip_address"
 	LabelPrimaryInterface = "primary_interface"
+	LabelNetmask          = "netmask"
 )
 
 var interfaceMetrics = []metrics.Gauge{
 	{
 		Name:   InterfaceRxBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "interface_rx_bitrate_bytes_per_second",
 		Desc:   "Receive bitrate in bits per second for the interface",
 		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
 	},
 	{
 		Name:   InterfaceTxBitrate,
+		Unit:   metrics.UnitBitsPerSecond,
+		Legacy: "interface_tx_bitrate_bytes_per_second",
 		Desc:   "Transmit bitrate in bits per second for the interface",
 		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
 	},
 	{
 		Name:   InterfaceLinkSpeed,
+		Unit:   metrics.UnitBitsPerSecond,
 		Desc:   "Ethernet link speed in bits per second. -1 if unknown",
 		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
 	},
@@ -52,34 +59,51 @@ var interfaceMetrics = []metrics.Gauge{
 		Desc:   "Boolean indicating if the interface is testing internet access (1 = yes, 0 = no)",
 		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
 	},
+	{
+		Name:   InterfaceInfo,
+		Desc:   "Interface configuration with its index and netmask as labels. The index matches the network_interface label of the bonding path metrics. Value is always 1",
+		Labels: []string{LabelNetworkInterface, LabelInterfaceMAC, LabelIPAddress, LabelNetmask, LabelPrimaryInterface},
+	},
+	{
+		Name:   InterfaceLinkUp,
+		Desc:   "Boolean indicating if the ethernet link is up (1 = up, 0 = down). Not exported while the link speed is unknown",
+		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
+	},
 }
 
-func interfaces(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error {
-	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/network_interfaces/status", url, unitEndpoint, id), nil)
-	if err != nil {
-		return err
-	}
+var interfaceStateSets = []metrics.StateSet{
+	{
+		Name:   InterfaceDuplex,
+		Desc:   "Ethernet duplex mode of the interface",
+		Labels: []string{LabelInterfaceMAC, LabelIPAddress, LabelPrimaryInterface},
+		States: []string{"full", "half"},
+	},
+}
 
-	mtrcs := metrics.NewGaugeMap(interfaceMetrics)
+func interfaces(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	mtrcs := metrics.NewGaugeMap(interfaceMetrics, opts.metricOptions(FamilyInterface))
 	for _, metric := range mtrcs {
 		registry.MustRegister(metric)
 		metric.Reset()
 	}
 
-	res, err := doReq(l, request)
-	if err != nil {
-		return err
+	stateSets := metrics.NewStateSetMap(interfaceStateSets, opts.metricOptions(FamilyInterface))
+	for _, metric := range stateSets {
+		registry.MustRegister(metric)
+		metric.Reset()
 	}
 
-	var interfaces models.StatusResponse
-	err = json.Unmarshal(res, &interfaces)
+	interfaces, err := unit.GetNetworkInterfacesStatus(ctx)
 	if err != nil {
 		return err
 	}
 
 	l.Trace().Msg("Successfully retrieved metrics for network interfaces status")
 
-	for _, nwint := range interfaces.Status {
+	// Interfaces are identified by their MAC address, which doesn't change when interfaces are
+	// reordered or added. The status carries no index, the info metric takes it from the position
+	// in the status, which is the index bonding paths link to.
+	for i, nwint := range interfaces.Status {
 		mac := nwint.Ethernet.Address
 		ip := nwint.IP.Address
 		isPri := nwint.PrimaryInterface
@@ -88,6 +112,13 @@ func interfaces(ctx context.Context, l zerolog.Logger, registry prometheus.Regis
 		mtrcs[InterfaceLinkSpeed].WithLabelValues(mac, ip, metrics.BoolToString(isPri)).Set(nwint.Ethernet.Link)
 		mtrcs[InterfaceInternetAccess].WithLabelValues(mac, ip, metrics.BoolToString(isPri)).Set(metrics.BoolToFloat64(nwint.InternetAccess))
 		mtrcs[InterfaceTestingInternetAccess].WithLabelValues(mac, ip, metrics.BoolToString(isPri)).Set(metrics.BoolToFloat64(nwint.TestingInternetAccess))
+		// There is no separate link state, a link is up once it negotiated a speed and -1 means
+		// the speed is unknown
+		if nwint.Ethernet.Link >= 0 {
+			mtrcs[InterfaceLinkUp].WithLabelValues(mac, ip, metrics.BoolToString(isPri)).Set(metrics.BoolToFloat64(nwint.Ethernet.Link > 0))
+		}
+		mtrcs[InterfaceInfo].WithLabelValues(strconv.Itoa(i), mac, ip, nwint.IP.Netmask, metrics.BoolToString(isPri)).Set(1)
+		stateSets[InterfaceDuplex].Set(nwint.Ethernet.Duplex, mac, ip, metrics.BoolToString(isPri))
 	}
 
 	return err
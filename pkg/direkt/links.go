@@ -0,0 +1,35 @@
+package direkt
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+)
+
+const ResourcePresent = "resource_present"
+
+const LabelRel = "rel"
+
+var resourceMetrics = []metrics.Gauge{
+	{
+		Name:   ResourcePresent,
+		Desc:   "Resources linked from the unit root by their rel, including ones the exporter doesn't collect. Value is always 1",
+		Labels: []string{LabelRel},
+	},
+}
+
+func resources(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	mtrcs := metrics.NewGaugeMap(resourceMetrics, opts.metricOptions(FamilyResource))
+	for _, metric := range mtrcs {
+		registry.MustRegister(metric)
+		metric.Reset()
+	}
+
+	for _, rel := range unit.Rels() {
+		mtrcs[ResourcePresent].WithLabelValues(rel).Set(1)
+	}
+	return nil
+}
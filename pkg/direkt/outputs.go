@@ -2,15 +2,13 @@ package direkt
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"net/http"
 	"strconv"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
-	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
 )
 
 const (
@@ -18,19 +16,27 @@ const (
 	OutputAudioActive          = "output_audio_active"
 	OutputVideoSourceAvailable = "output_video_source_available"
 	OutputAudioSourceAvailable = "output_audio_source_available"
+	OutputVideoInfo            = "output_video_info"
+	OutputVideoWidth           = "output_video_width"
+	OutputVideoHeight          = "output_video_height"
+	OutputVideoFramerate       = "output_video_framerate"
+	OutputPortUsable           = "video_output_port_usable"
+	OutputPortInfo             = "video_output_port_info"
+	OutputSourceInfo           = "output_source_info"
 )
 
 const (
 	LabelSourceAvailable = "source_available"
 	LabelOutputIndex     = "output_index"
 	LabelOutputName      = "output_name"
-	LabelSourceIndex     = "source_index"
-	LabelSourceName      = "source_name"
 	LabelAudioCodecName  = "audio_codec_name"
 	LabelAudioChannels   = "audio_channels"
 	LabelAudioSampleRate = "audio_sample_rate"
 	LabelAudioBitDepth   = "audio_bit_depth"
 	LabelAudioIndex      = "audio_index"
+	LabelVideoCard       = "video_card"
+	LabelPortIndex       = "port_index"
+	LabelConnectorName   = "connector_name"
 )
 
 var videoMetrics = []metrics.Gauge{
@@ -67,8 +73,10 @@ var videoMetrics = []metrics.Gauge{
 		Name: OutputVideoSourceAvailable,
 		Desc: "Indicates if the video source is available (1=active, 0=inactive) with video format properties as labels",
 		Labels: []string{
-			LabelSourceIndex,
-			LabelSourceName,
+			LabelOutputIndex,
+			LabelOutputName,
+			LabelSource,
+			LabelProgramID,
 			LabelCodecName,
 			LabelCodecBitrate,
 			LabelProfile,
@@ -88,8 +96,10 @@ var videoMetrics = []metrics.Gauge{
 		Name: OutputAudioSourceAvailable,
 		Desc: "Indicates if the audio source is available (1=active, 0=inactive) with audio format properties as labels",
 		Labels: []string{
-			LabelSourceIndex,
-			LabelSourceName,
+			LabelOutputIndex,
+			LabelOutputName,
+			LabelSource,
+			LabelProgramID,
 			LabelAudioIndex,
 			LabelAudioCodecName,
 			LabelAudioChannels,
@@ -97,67 +107,156 @@ var videoMetrics = []metrics.Gauge{
 			LabelAudioBitDepth,
 		},
 	},
+	{
+		Name: OutputSourceInfo,
+		Desc: "Network input and program shown on the output, e.g. network_inputs/0. Value is always 1",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+			LabelSource,
+			LabelProgramID,
+		},
+	},
+	{
+		Name: OutputPortUsable,
+		Desc: "Indicates if the video card port of the output is usable (1=usable, 0=failed or removed)",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+		},
+	},
+	{
+		Name: OutputPortInfo,
+		Desc: "Video card, port index and connector name of the output as labels. Value is always 1",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+			LabelVideoCard,
+			LabelPortIndex,
+			LabelConnectorName,
+		},
+	},
 }
 
-func outputs(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error {
-	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/video_outputs", url, unitEndpoint, id), nil)
-	if err != nil {
-		return err
-	}
-
-	res, err := doReq(l, request)
-	if err != nil {
-		return err
-	}
+// videoMetricsV2 replaces the label-heavy video gauges of videoMetrics when the v2 schema is selected
+var videoMetricsV2 = []metrics.Gauge{
+	{
+		Name: OutputVideoActive,
+		Desc: "Indicates if the video output is active (1=active, 0=inactive)",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+		},
+	},
+	{
+		Name: OutputVideoInfo,
+		Desc: "Video output format properties as labels. Value is always 1",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+			LabelBitDepth,
+			LabelInterlaced,
+			LabelChromaSubsampling,
+			LabelPixelAspect,
+			LabelDisplayAspect,
+			LabelTopFieldFirst,
+		},
+	},
+	{
+		Name: OutputVideoWidth,
+		Unit: metrics.UnitPixels,
+		Desc: "Video output width in pixels",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+		},
+	},
+	{
+		Name: OutputVideoHeight,
+		Unit: metrics.UnitPixels,
+		Desc: "Video output height in pixels",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+		},
+	},
+	{
+		Name: OutputVideoFramerate,
+		Desc: "Video output framerate in frames per second",
+		Labels: []string{
+			LabelOutputIndex,
+			LabelOutputName,
+		},
+	},
+}
 
-	var outputs models.VideoOutputsResponse
-	err = json.Unmarshal(res, &outputs)
+func outputs(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	outputs, err := unit.ListVideoOutputs(ctx)
 	if err != nil {
 		return err
 	}
 
-	mtrcs := metrics.NewGaugeMap(videoMetrics)
+	mtrcs := metrics.NewGaugeMap(withSchema(opts.Schema, videoMetrics, videoMetricsV2), opts.metricOptions(FamilyVideoOutput))
 	for _, metric := range mtrcs {
 		registry.MustRegister(metric)
 		metric.Reset()
 	}
 
 	for _, output := range outputs.VideoOutputs {
-		request, err = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/video_outputs/%d/status", url, unitEndpoint, id, output.Index), nil)
-		if err != nil {
-			l.Err(err).Int("output_index", output.Index).Msg("Error creating output request, skipping")
-			continue
-		}
-		res, err := doReq(l, request)
-		if err != nil {
-			l.Err(err).Int("output_index", output.Index).Msg("Error getting output metrics, skipping")
-			continue
-		}
+		outputIdx := strconv.Itoa(output.Index)
 
-		var e models.VideoOutputStatus
-		err = json.Unmarshal(res, &e)
+		// The port is reported by the list, so a failed card still shows up when the status can't be read
+		mtrcs[OutputPortUsable].WithLabelValues(outputIdx, output.Description).Set(metrics.BoolToFloat64(output.VideoPort.Usable))
+
+		e, err := unit.GetVideoOutputStatus(ctx, output)
 		if err != nil {
-			l.Err(err).Int("output_index", output.Index).Msg("Error decoding output status response, skipping")
+			l.Err(err).Int("output_index", output.Index).Msg("Error getting output metrics, skipping")
 			continue
 		}
 
-		mtrcs[OutputVideoActive].WithLabelValues(
-			strconv.Itoa(output.Index),
+		mtrcs[OutputPortInfo].WithLabelValues(
+			outputIdx,
 			output.Description,
-			strconv.Itoa(e.VideoOut.Video.Format.Width),
-			strconv.Itoa(e.VideoOut.Video.Format.Height),
-			fmt.Sprintf("%.2f", e.VideoOut.Video.Format.Framerate),
-			strconv.Itoa(e.VideoOut.Video.Format.BitDepth),
-			metrics.BoolToString(e.VideoOut.Video.Format.Interlaced),
-			e.VideoOut.Video.Format.ChromaSubsampling,
-			e.VideoOut.Video.Format.PixelAspect,
-			e.VideoOut.Video.Format.DisplayAspect,
-			metrics.BoolToString(e.VideoOut.Video.Format.TopFieldFirst),
-		).Set(metrics.BoolToFloat64(e.Active))
+			output.VideoPort.VideoCard,
+			strconv.Itoa(output.VideoPort.PortIndex),
+			e.VideoOut.ConnectorName,
+		).Set(1)
+
+		if opts.Schema == SchemaV2 {
+			format := e.VideoOut.Video.Format
+			mtrcs[OutputVideoActive].WithLabelValues(outputIdx, output.Description).Set(metrics.BoolToFloat64(e.Active))
+			mtrcs[OutputVideoInfo].WithLabelValues(
+				outputIdx,
+				output.Description,
+				strconv.Itoa(format.BitDepth),
+				metrics.BoolToString(format.Interlaced),
+				format.ChromaSubsampling,
+				format.PixelAspect,
+				format.DisplayAspect,
+				metrics.BoolToString(format.TopFieldFirst),
+			).Set(1)
+			mtrcs[OutputVideoWidth].WithLabelValues(outputIdx, output.Description).Set(float64(format.Width))
+			mtrcs[OutputVideoHeight].WithLabelValues(outputIdx, output.Description).Set(float64(format.Height))
+			mtrcs[OutputVideoFramerate].WithLabelValues(outputIdx, output.Description).Set(format.Framerate)
+		} else {
+			mtrcs[OutputVideoActive].WithLabelValues(
+				outputIdx,
+				output.Description,
+				strconv.Itoa(e.VideoOut.Video.Format.Width),
+				strconv.Itoa(e.VideoOut.Video.Format.Height),
+				fmt.Sprintf("%.2f", e.VideoOut.Video.Format.Framerate),
+				strconv.Itoa(e.VideoOut.Video.Format.BitDepth),
+				metrics.BoolToString(e.VideoOut.Video.Format.Interlaced),
+				e.VideoOut.Video.Format.ChromaSubsampling,
+				e.VideoOut.Video.Format.PixelAspect,
+				e.VideoOut.Video.Format.DisplayAspect,
+				metrics.BoolToString(e.VideoOut.Video.Format.TopFieldFirst),
+			).Set(metrics.BoolToFloat64(e.Active))
+		}
 
 		for i, audio := range e.VideoOut.Audio {
 			mtrcs[OutputAudioActive].WithLabelValues(
-				strconv.Itoa(output.Index),
+				outputIdx,
 				output.Description,
 				strconv.Itoa(i),
 				strconv.Itoa(audio.Format.Channels),
@@ -166,9 +265,16 @@ func outputs(ctx context.Context, l zerolog.Logger, registry prometheus.Register
 			).Set(metrics.BoolToFloat64(e.Active))
 		}
 
+		source := simplifySource(e.VideoSource.Source)
+		programID := strconv.Itoa(e.VideoSource.ProgramID)
+		opts.state.addThumbnail(ThumbnailVideoOutput, outputIdx, output.Description, e.VideoSource.Thumbnail)
+		mtrcs[OutputSourceInfo].WithLabelValues(outputIdx, output.Description, source, programID).Set(1)
+
 		mtrcs[OutputVideoSourceAvailable].WithLabelValues(
-			strconv.Itoa(output.Index),
+			outputIdx,
 			output.Description,
+			source,
+			programID,
 			e.VideoSource.Video.Codec.Name,
 			strconv.Itoa(e.VideoSource.Video.Codec.Bitrate),
 			e.VideoSource.Video.Codec.Profile,
@@ -184,10 +290,12 @@ func outputs(ctx context.Context, l zerolog.Logger, registry prometheus.Register
 			metrics.BoolToString(e.VideoSource.Video.Format.TopFieldFirst),
 		).Set(metrics.BoolToFloat64(e.VideoSource.Available))
 
-		for i, audio := range e.VideoOut.Audio {
+		for i, audio := range e.VideoSource.Audio {
 			mtrcs[OutputAudioSourceAvailable].WithLabelValues(
-				strconv.Itoa(output.Index),
+				outputIdx,
 				output.Description,
+				source,
+				programID,
 				strconv.Itoa(i),
 				audio.Codec.Name,
 				strconv.Itoa(audio.Format.Channels),
@@ -195,7 +303,6 @@ func outputs(ctx context.Context, l zerolog.Logger, registry prometheus.Register
 				strconv.Itoa(audio.Format.BitDepth),
 			).Set(metrics.BoolToFloat64(e.VideoSource.Available))
 		}
-
 	}
 
 	return err
@@ -0,0 +1,119 @@
+package direkt
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
+)
+
+// unitState holds the metrics that accumulate across polls of a unit
+type unitState struct {
+	// integrators turn bitrates into byte counters, keyed by family and metric name
+	integrators map[string]map[string]*metrics.Integrator
+	// histograms accumulate samples of every poll, keyed by family and metric name
+	histograms map[string]map[string]*metrics.HistogramVec
+	// unitTime is the time reported by the unit in its last system status
+	unitTime time.Time
+	// thumbnailSources are the thumbnails reported during the current poll
+	thumbnailSources []thumbnailSource
+	// thumbnails holds the last change of each analysed thumbnail, keyed by kind and index
+	thumbnails map[string]thumbnailHistory
+}
+
+func newUnitState(opts Options, interval time.Duration) *unitState {
+	// Gaps of a few missed polls are still integrated, longer outages are skipped
+	maxGap := 3 * interval
+	return &unitState{
+		integrators: map[string]map[string]*metrics.Integrator{
+			FamilyEncoder:      metrics.NewIntegratorMap(encoderCounters, opts.metricOptions(FamilyEncoder), maxGap),
+			FamilyNetworkInput: metrics.NewIntegratorMap(networkInputCounters, opts.metricOptions(FamilyNetworkInput), maxGap),
+		},
+		histograms: map[string]map[string]*metrics.HistogramVec{
+			FamilyEncoder: metrics.NewHistogramMap(encoderHistograms, opts.metricOptions(FamilyEncoder)),
+		},
+		thumbnails: make(map[string]thumbnailHistory),
+	}
+}
+
+// registerIntegrators registers the integrators of a family and returns them. It returns nil
+// when the unit isn't polled, as rates can't be integrated over independent probes.
+func (s *unitState) registerIntegrators(registry prometheus.Registerer, family string) map[string]*metrics.Integrator {
+	if s == nil {
+		return nil
+	}
+	integrators := s.integrators[family]
+	for _, integrator := range integrators {
+		registry.MustRegister(integrator)
+	}
+	return integrators
+}
+
+// registerHistograms registers the histograms of a family and returns them. It returns nil
+// when the unit isn't polled, as a single probe only yields one sample per series.
+func (s *unitState) registerHistograms(registry prometheus.Registerer, family string) map[string]*metrics.HistogramVec {
+	if s == nil {
+		return nil
+	}
+	histograms := s.histograms[family]
+	for _, histogram := range histograms {
+		registry.MustRegister(histogram)
+	}
+	return histograms
+}
+
+type polledMetrics struct {
+	registry *prometheus.Registry
+	err      error
+	// timestamp is the time reported by the unit when the metrics were polled
+	timestamp time.Time
+}
+
+// Poll gathers metrics for each serial every interval until ctx is cancelled. Probes for a
+// polled serial are answered from its most recent poll.
+func (d *Direkt) Poll(ctx context.Context, l zerolog.Logger, serials []string, interval time.Duration) {
+	var wg sync.WaitGroup
+	for _, id := range serials {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.pollUnit(ctx, l.With().Str("serial", id).Logger(), id, interval)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Direkt) pollUnit(ctx context.Context, l zerolog.Logger, id string, interval time.Duration) {
+	state := newUnitState(d.opts, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		state.unitTime = time.Time{}
+		state.thumbnailSources = nil
+		pollCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		registry, err := d.gatherMetrics(pollCtx, l, gatherers, id, state)
+		cancel()
+
+		d.mu.Lock()
+		d.polled[id] = polledMetrics{registry: registry, err: err, timestamp: state.unitTime}
+		d.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lastPoll returns the most recent poll of a unit, or false if the unit isn't polled yet
+func (d *Direkt) lastPoll(id string) (polledMetrics, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	p, ok := d.polled[id]
+	return p, ok
+}
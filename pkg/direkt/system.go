@@ -2,27 +2,26 @@ package direkt
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
 	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/metrics"
-	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
 )
 
 // Metric names
 const (
 	SystemInfo            = "system_info"
-	CPUUtilisationPercent = "cpu_utilisation_percent"
-	MemoryTotalBytes      = "memory_total_bytes"
-	MemoryAvailableBytes  = "memory_available_bytes"
-	BondingPathRTTSeconds = "bonding_path_rtt_seconds"
-	BondingPathRxBitrate  = "bonding_path_rx_bitrate_bytes_per_second"
-	BondingPathTxBitrate  = "bonding_path_tx_bitrate_bytes_per_second"
+	CPUUtilisation        = "cpu_utilisation"
+	MemoryTotalBytes      = "memory_total"
+	MemoryAvailableBytes  = "memory_available"
+	BondingPathRTTSeconds = "bonding_path_rtt"
+	BondingPathRxBitrate  = "bonding_path_rx_bitrate"
+	BondingPathTxBitrate  = "bonding_path_tx_bitrate"
 	BondingPathHealth     = "bonding_path_health"
+	BondingPathHTTPS      = "bonding_path_https_connectivity"
+	RemoteManagement      = "remote_management_status"
 )
 
 // Label names
@@ -40,73 +39,119 @@ var sysMetrics = []metrics.Gauge{
 		Labels: []string{LabelActiveFirmwareVersion, LabelBackupFirmwareVersion, LabelDefaultFirmwareVersion},
 	},
 	{
-		Name:   CPUUtilisationPercent,
-		Desc:   "Percentage of CPU utilisation",
+		Name:   CPUUtilisation,
+		Unit:   metrics.UnitRatio,
+		Legacy: "cpu_utilisation_percent",
+		Desc:   "CPU utilisation ratio (0-1). Percentage when legacy names are enabled",
 		Labels: []string{},
 	},
 	{
 		Name:   MemoryTotalBytes,
+		Unit:   metrics.UnitBytes,
 		Desc:   "Total amount of memory in bytes",
 		Labels: []string{},
 	},
 	{
 		Name:   MemoryAvailableBytes,
+		Unit:   metrics.UnitBytes,
 		Desc:   "Amount of memory available in bytes",
 		Labels: []string{},
 	},
 	{
 		Name:   BondingPathRTTSeconds,
+		Unit:   metrics.UnitSeconds,
 		Desc:   "Round trip time in seconds for bonding path",
 		Labels: []string{LabelNetworkInterface},
 	},
 	{
 		Name:   BondingPathRxBitrate,
+		Unit:   metrics.UnitBytesPerSecond,
 		Desc:   "Receive bitrate in bytes per second for bonding path",
 		Labels: []string{LabelNetworkInterface},
 	},
 	{
 		Name:   BondingPathTxBitrate,
+		Unit:   metrics.UnitBytesPerSecond,
 		Desc:   "Transmit bitrate in bytes per second for bonding path",
 		Labels: []string{LabelNetworkInterface},
 	},
+	{
+		Name:       BondingPathHealth,
+		Desc:       "Network management bonding path health (1 = ok, 0 = anything else)",
+		Labels:     []string{LabelNetworkInterface},
+		LegacyOnly: true,
+	},
+}
+
+// The API doesn't enumerate the path health and HTTPS connectivity values. Only "ok" is known,
+// other values are exported as the unit reports them.
+var sysStateSets = []metrics.StateSet{
 	{
 		Name:   BondingPathHealth,
+		Legacy: "bonding_path_health_state",
 		Desc:   "Network management bonding path health",
 		Labels: []string{LabelNetworkInterface},
+		States: []string{"ok"},
+	},
+	{
+		Name:   BondingPathHTTPS,
+		Desc:   "HTTPS connectivity status of the network management bonding path",
+		Labels: []string{LabelNetworkInterface},
+		States: []string{"ok"},
+	},
+	{
+		Name:   RemoteManagement,
+		Desc:   "Remote management connection status",
+		Labels: []string{},
+		States: []string{"connected", "disconnected"},
 	},
 }
 
-func system(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, doReq func(l zerolog.Logger, request *http.Request) ([]byte, error), id string) error {
-	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s%s%s/system/status", url, unitEndpoint, id), nil)
-	if err != nil {
-		return err
+func system(ctx context.Context, l zerolog.Logger, registry prometheus.Registerer, unit *iss.Unit, opts Options) error {
+	mtrcs := metrics.NewGaugeMap(sysMetrics, opts.metricOptions(FamilySystem))
+	for _, metric := range mtrcs {
+		registry.MustRegister(metric)
+		metric.Reset()
 	}
 
-	mtrcs := metrics.NewGaugeMap(sysMetrics)
-	for _, metric := range mtrcs {
+	stateSets := metrics.NewStateSetMap(sysStateSets, opts.metricOptions(FamilySystem))
+	for _, metric := range stateSets {
 		registry.MustRegister(metric)
 		metric.Reset()
 	}
 
-	var info models.SystemResponse
 	var success float64 = 0
 
-	res, err := doReq(l, request)
+	info, err := unit.GetSystemStatus(ctx)
 	if err == nil {
-		err = json.Unmarshal(res, &info)
-		if err == nil {
-			l.Trace().Msg("Successfully retrieved metrics for system status")
-			success = 1
-			mtrcs[CPUUtilisationPercent].WithLabelValues().Set(info.CPU.Usage)
-			mtrcs[MemoryAvailableBytes].WithLabelValues().Set(float64(info.Memory.Available))
-			mtrcs[MemoryTotalBytes].WithLabelValues().Set(float64(info.Memory.Total))
-			for _, path := range info.RemoteManagement.Bonding.Paths {
-				ni := simplifyNetworkInterface(path.NetworkInterface)
-				mtrcs[BondingPathRTTSeconds].WithLabelValues(ni).Set(path.RTT)
-				mtrcs[BondingPathRxBitrate].WithLabelValues(ni).Set(float64(path.RxBitrate))
-				mtrcs[BondingPathTxBitrate].WithLabelValues(ni).Set(float64(path.TxBitrate))
+		l.Trace().Msg("Successfully retrieved metrics for system status")
+		success = 1
+		if opts.state != nil {
+			opts.state.unitTime = info.Datetime
+		}
+		if opts.LegacyNames {
+			mtrcs[CPUUtilisation].WithLabelValues().Set(info.CPU.Usage)
+		} else {
+			mtrcs[CPUUtilisation].WithLabelValues().Set(info.CPU.Usage / 100)
+		}
+		mtrcs[MemoryAvailableBytes].WithLabelValues().Set(float64(info.Memory.Available))
+		mtrcs[MemoryTotalBytes].WithLabelValues().Set(float64(info.Memory.Total))
+		// The status description is free text, the connection state is taken from connected
+		if info.RemoteManagement.Connected {
+			stateSets[RemoteManagement].Set("connected")
+		} else {
+			stateSets[RemoteManagement].Set("disconnected")
+		}
+		for _, path := range info.RemoteManagement.Bonding.Paths {
+			ni := simplifyNetworkInterface(path.NetworkInterface)
+			mtrcs[BondingPathRTTSeconds].WithLabelValues(ni).Set(path.RTT)
+			mtrcs[BondingPathRxBitrate].WithLabelValues(ni).Set(float64(path.RxBitrate))
+			mtrcs[BondingPathTxBitrate].WithLabelValues(ni).Set(float64(path.TxBitrate))
+			if opts.LegacyNames {
 				mtrcs[BondingPathHealth].WithLabelValues(ni).Set(float64(metrics.StringBoolToInt(path.Health)))
 			}
+			stateSets[BondingPathHealth].Set(path.Health, ni)
+			stateSets[BondingPathHTTPS].Set(path.HttpsConnectivityStatus, ni)
 		}
 	}
 
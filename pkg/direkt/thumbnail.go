@@ -0,0 +1,174 @@
+package direkt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/iss"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
+)
+
+// Thumbnail kinds accepted by HandleThumbnail
+const (
+	ThumbnailEncoder      = "encoder"
+	ThumbnailNetworkInput = "network_input"
+	ThumbnailVideoOutput  = "video_output"
+)
+
+var thumbnailKinds = []string{ThumbnailEncoder, ThumbnailNetworkInput, ThumbnailVideoOutput}
+
+// thumbnailTTL is how long a thumbnail is served from the cache before it is fetched again
+const thumbnailTTL = 5 * time.Second
+
+var errNoThumbnail = errors.New("no thumbnail available")
+
+type thumbnail struct {
+	image   []byte
+	fetched time.Time
+}
+
+// HandleThumbnail proxies the confidence thumbnail of an encoder, network input or video output
+// through the authenticated client, so browsers never see the ISS credentials. Network inputs
+// show their first program unless a program number is given.
+func (d *Direkt) HandleThumbnail(w http.ResponseWriter, r *http.Request, l zerolog.Logger) {
+	id, err := validateRequest(r)
+	if err != nil {
+		l.Err(err).Msg("Error validating request parameters")
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	params := r.URL.Query()
+	kind := params.Get("kind")
+	if !slices.Contains(thumbnailKinds, kind) {
+		http.Error(w, "invalid kind provided", http.StatusBadRequest)
+		return
+	}
+	index, err := strconv.Atoi(params.Get("index"))
+	if err != nil || index < 0 {
+		http.Error(w, "invalid index provided", http.StatusBadRequest)
+		return
+	}
+	program := params.Get("program")
+	l = l.With().Str("serial", id).Str("kind", kind).Int("index", index).Logger()
+
+	// Only fetched thumbnails are cached, so programs the unit doesn't have never make it into
+	// the cache
+	key := fmt.Sprintf("%s/%s/%d/%s", id, kind, index, program)
+	cached, ok := d.cachedThumbnail(key)
+	if !ok {
+		// Concurrent requests for the same thumbnail share one fetch, which isn't cancelled when
+		// the request that started it goes away
+		v, err, _ := d.thumbnailFetches.Do(key, func() (any, error) {
+			ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), 10*time.Second)
+			defer cancel()
+			image, err := d.fetchThumbnail(ctx, l, id, kind, index, program)
+			if err != nil {
+				return thumbnail{}, err
+			}
+			t := thumbnail{image: image, fetched: time.Now()}
+			d.storeThumbnail(key, t)
+			return t, nil
+		})
+		if err != nil {
+			l.Err(err).Msg("Error fetching thumbnail")
+			switch {
+			case errors.Is(err, errNoThumbnail), errors.Is(err, iss.ErrForeignPath):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			case errors.Is(err, iss.ErrUnitOffline):
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			default:
+				http.Error(w, err.Error(), http.StatusBadGateway)
+			}
+			return
+		}
+		cached = v.(thumbnail)
+	}
+
+	w.Header().Set("Content-Type", http.DetectContentType(cached.image))
+	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(thumbnailTTL.Seconds())))
+	w.Write(cached.image)
+}
+
+// cachedThumbnail returns a thumbnail that hasn't expired yet
+func (d *Direkt) cachedThumbnail(key string) (thumbnail, bool) {
+	d.thumbnailMu.Lock()
+	defer d.thumbnailMu.Unlock()
+	d.expireThumbnails()
+	t, ok := d.thumbnails[key]
+	return t, ok
+}
+
+// storeThumbnail caches a thumbnail
+func (d *Direkt) storeThumbnail(key string, t thumbnail) {
+	d.thumbnailMu.Lock()
+	defer d.thumbnailMu.Unlock()
+	d.expireThumbnails()
+	d.thumbnails[key] = t
+}
+
+// expireThumbnails drops expired entries, so the cache only holds thumbnails that are still
+// being requested. The caller must hold thumbnailMu.
+func (d *Direkt) expireThumbnails() {
+	for k, cached := range d.thumbnails {
+		if time.Since(cached.fetched) > thumbnailTTL {
+			delete(d.thumbnails, k)
+		}
+	}
+}
+
+// fetchThumbnail looks up the thumbnail path in the status of the resource and downloads it
+func (d *Direkt) fetchThumbnail(ctx context.Context, l zerolog.Logger, id, kind string, index int, program string) ([]byte, error) {
+	ctx = l.WithContext(ctx)
+	unit := d.client.Unit(id)
+
+	var path string
+	switch kind {
+	case ThumbnailEncoder:
+		status, err := unit.GetEncoderStatus(ctx, models.Encoder{Index: index})
+		if err != nil {
+			return nil, err
+		}
+		path = status.VideoSource.Thumbnail
+	case ThumbnailNetworkInput:
+		status, err := unit.GetNetworkInputStatus(ctx, models.NetworkInput{Index: index})
+		if err != nil {
+			return nil, err
+		}
+		programs := status.NetworkSource.Programs
+		i := 0
+		if program != "" {
+			i = programIndex(programs, program)
+			if i < 0 {
+				return nil, fmt.Errorf("%w: unknown program %q", errNoThumbnail, program)
+			}
+		}
+		if i < len(programs) {
+			path = programs[i].Thumbnail
+		}
+	case ThumbnailVideoOutput:
+		status, err := unit.GetVideoOutputStatus(ctx, models.VideoOutput{Index: index})
+		if err != nil {
+			return nil, err
+		}
+		path = status.VideoSource.Thumbnail
+	}
+
+	if path == "" {
+		return nil, errNoThumbnail
+	}
+	return unit.GetThumbnail(ctx, path)
+}
+
+// programIndex returns the position of the first program whose program_number or program_id
+// label is program, or -1 if there is none
+func programIndex(programs []models.Program, program string) int {
+	return slices.IndexFunc(programs, func(prog models.Program) bool {
+		return strconv.Itoa(prog.Number) == program || (prog.ID != "" && prog.ID == program)
+	})
+}
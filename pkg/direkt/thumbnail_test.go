@@ -0,0 +1,30 @@
+package direkt
+
+import (
+	"testing"
+
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
+)
+
+func TestProgramIndex(t *testing.T) {
+	programs := []models.Program{
+		{Number: 0, ID: ""},
+		{Number: 101, ID: "0x0065"},
+		{Number: 101, ID: "0x0066"},
+	}
+	tests := []struct {
+		program string
+		want    int
+	}{
+		{"0", 0},
+		{"101", 1},
+		{"0x0066", 2},
+		{"", -1},
+		{"102", -1},
+	}
+	for _, tt := range tests {
+		if got := programIndex(programs, tt.program); got != tt.want {
+			t.Errorf("programIndex(%q) = %d, want %d", tt.program, got, tt.want)
+		}
+	}
+}
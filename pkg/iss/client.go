@@ -0,0 +1,110 @@
+// Package iss is a client for the unit API of the Intinor ISS (Intinor Stream Service)
+package iss
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultBaseURL is the ISS the client talks to unless BaseURL is changed
+	DefaultBaseURL = "https://iss.intinor.se/"
+	unitEndpoint   = "api/v1/units/"
+)
+
+// ErrUnitOffline is returned when ISS reports the unit as unreachable
+var ErrUnitOffline = errors.New("unit offline")
+
+// ErrForeignPath is returned for paths that don't belong to the unit they are requested from
+var ErrForeignPath = errors.New("path doesn't belong to the unit")
+
+// StatusError is returned when ISS answers with a status code other than 200 OK or 503
+type StatusError struct {
+	StatusCode int
+	URL        string
+}
+
+// Error reports the status code of the response
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("non-okay request returned: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Client requests the unit API of ISS. Requests are logged through the zerolog logger of their
+// context, see zerolog.Logger.WithContext.
+type Client struct {
+	// BaseURL is the ISS address, ending in a slash
+	BaseURL    string
+	Username   string
+	Password   string
+	HTTPClient *http.Client
+}
+
+// New returns a client for DefaultBaseURL. Requests aren't authenticated when username or
+// password is empty.
+func New(username, password string) *Client {
+	return &Client{
+		BaseURL:  DefaultBaseURL,
+		Username: username,
+		Password: password,
+		HTTPClient: &http.Client{
+			Timeout: 15 * time.Second,
+		},
+	}
+}
+
+// Get requests a path relative to BaseURL and returns the response body
+func (c *Client) Get(ctx context.Context, path string) ([]byte, error) {
+	l := zerolog.Ctx(ctx)
+	req, err := http.NewRequestWithContext(ctx, "GET", c.BaseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.Username != "" && c.Password != "" {
+		l.Debug().Msg("Authentication set")
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+	l.Trace().Str("url", req.URL.String()).Msg("Sending request")
+	res, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode == http.StatusServiceUnavailable {
+		return nil, ErrUnitOffline
+	}
+
+	if res.StatusCode != http.StatusOK {
+		l.Info().Int("status_code", res.StatusCode).Str("request", req.URL.String()).Msg("Non-OK status code returned")
+		return nil, &StatusError{StatusCode: res.StatusCode, URL: req.URL.String()}
+	}
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	l.Trace().Str("url", req.URL.String()).Msg("Finished request, returning body")
+	return body, nil
+}
+
+// GetJSON requests a path relative to BaseURL and decodes the JSON response into v
+func (c *Client) GetJSON(ctx context.Context, path string, v any) error {
+	res, err := c.Get(ctx, path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(res, v)
+}
+
+// Unit returns the unit with the given serial. Its resources are found at their default paths
+// until Discover reads the links of the unit root.
+func (c *Client) Unit(id string) *Unit {
+	return &Unit{client: c, id: id}
+}
@@ -0,0 +1,182 @@
+package iss
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newTestClient returns a client for a test server answering with handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	c := New("user", "secret")
+	c.BaseURL = srv.URL + "/"
+	return c
+}
+
+func TestClientBasicAuth(t *testing.T) {
+	var user, password string
+	var ok bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok = r.BasicAuth()
+		w.Write([]byte(`{}`))
+	})
+
+	if _, err := c.Unit("D01234").GetSystemStatus(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !ok || user != "user" || password != "secret" {
+		t.Errorf("got basic auth %q:%q (%v), want user:secret", user, password, ok)
+	}
+}
+
+func TestClientWithoutCredentials(t *testing.T) {
+	var ok bool
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _, ok = r.BasicAuth()
+		w.Write([]byte(`{}`))
+	})
+	c.Username, c.Password = "", ""
+
+	if _, err := c.Get(context.Background(), "api/v1/units/D01234"); err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("request carried basic auth without credentials")
+	}
+}
+
+func TestClientUnitOffline(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := c.Unit("D01234").ListEncoders(context.Background())
+	if !errors.Is(err, ErrUnitOffline) {
+		t.Errorf("got error %v, want ErrUnitOffline", err)
+	}
+}
+
+func TestClientStatusError(t *testing.T) {
+	for _, code := range []int{http.StatusUnauthorized, http.StatusNotFound, http.StatusInternalServerError} {
+		c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(code)
+		})
+
+		_, err := c.Unit("D01234").GetSystemStatus(context.Background())
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Errorf("status %d: got error %v, want *StatusError", code, err)
+			continue
+		}
+		if statusErr.StatusCode != code {
+			t.Errorf("got status code %d, want %d", statusErr.StatusCode, code)
+		}
+		if errors.Is(err, ErrUnitOffline) {
+			t.Errorf("status %d reported as unit offline", code)
+		}
+	}
+}
+
+func TestUnitForeignPath(t *testing.T) {
+	var requests int
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{}`))
+	})
+	unit := c.Unit("D01234")
+
+	for _, p := range []string{
+		"/api/v1/units/D09999/encoders",
+		"/api/v1/units/D01234/../D09999/encoders",
+		"/api/v1/units/D01234/encoders/../../D09999/encoders",
+		"/api/v1/units/D012345/encoders",
+		"/api/v1/units/D01234",
+		"../D09999/encoders",
+		"encoders/../../D09999/encoders",
+		"/other/api",
+	} {
+		if _, err := unit.Get(context.Background(), p); !errors.Is(err, ErrForeignPath) {
+			t.Errorf("Get(%q) returned %v, want ErrForeignPath", p, err)
+		}
+	}
+	if _, err := unit.GetThumbnail(context.Background(), "thumbnail"); !errors.Is(err, ErrForeignPath) {
+		t.Errorf("GetThumbnail of a relative path returned %v, want ErrForeignPath", err)
+	}
+	if requests != 0 {
+		t.Errorf("foreign paths caused %d requests", requests)
+	}
+}
+
+func TestUnitResolve(t *testing.T) {
+	unit := New("", "").Unit("D01234")
+	tests := []struct {
+		in, want string
+	}{
+		{"system/status", "api/v1/units/D01234/system/status"},
+		{"/api/v1/units/D01234/encoders/0/status", "api/v1/units/D01234/encoders/0/status"},
+		{"/api/v1/units/D01234/encoders/./0//status", "api/v1/units/D01234/encoders/0/status"},
+		{"encoders/1/../0/status", "api/v1/units/D01234/encoders/0/status"},
+		{"/api/v1/units/D01234/thumbnail.jpg?t=1/../2", "api/v1/units/D01234/thumbnail.jpg?t=1/../2"},
+	}
+	for _, tt := range tests {
+		got, err := unit.resolve(tt.in)
+		if err != nil {
+			t.Errorf("resolve(%q) returned %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("resolve(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestUnitFollowsLinks(t *testing.T) {
+	var paths []string
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		switch r.URL.Path {
+		case "/api/v1/units/D01234":
+			w.Write([]byte(`{"_links":[
+				{"rel":"system","href":"/api/v1/units/D01234/system","method":"GET"},
+				{"rel":"encoders","href":"/api/v1/units/D01234/v2/encoders","method":"GET"},
+				{"rel":"video_outputs","href":"/api/v1/units/D09999/video_outputs","method":"GET"}
+			]}`))
+		case "/api/v1/units/D01234/system":
+			w.Write([]byte(`{"_links":[{"rel":"status","href":"/api/v1/units/D01234/system/v2/status","method":"GET"}]}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	})
+	unit := c.Unit("D01234")
+	ctx := context.Background()
+
+	if err := unit.Discover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	unit.GetSystemStatus(ctx)
+	unit.ListEncoders(ctx)
+	unit.ListVideoOutputs(ctx)
+	unit.GetNetworkInterfacesStatus(ctx)
+
+	want := []string{
+		"/api/v1/units/D01234",
+		"/api/v1/units/D01234/system",
+		"/api/v1/units/D01234/system/v2/status",
+		"/api/v1/units/D01234/v2/encoders",
+		"/api/v1/units/D01234/video_outputs",
+		"/api/v1/units/D01234/network_interfaces/status",
+	}
+	if len(paths) != len(want) {
+		t.Fatalf("requested %v, want %v", paths, want)
+	}
+	for i := range want {
+		if paths[i] != want[i] {
+			t.Errorf("request %d went to %s, want %s", i, paths[i], want[i])
+		}
+	}
+}
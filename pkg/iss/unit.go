@@ -0,0 +1,230 @@
+package iss
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/vividbroadcast/prometheus-direkt-exporter/pkg/models"
+)
+
+// Rels of the links followed by Unit
+const (
+	RelEncoders          = "encoders"
+	RelNetworkInputs     = "network_inputs"
+	RelVideoOutputs      = "video_outputs"
+	RelSystem            = "system"
+	RelNetworkInterfaces = "network_interfaces"
+	RelStatus            = "status"
+)
+
+// statusRels are the resources linked from the unit root whose own status link Discover follows
+var statusRels = []string{RelSystem, RelNetworkInterfaces}
+
+// Unit requests the resources of a single unit. A Unit isn't safe for concurrent use while
+// Discover runs.
+type Unit struct {
+	client *Client
+	id     string
+	// links holds the hrefs linked from the unit root, keyed by rel
+	links map[string]string
+	// statusLinks holds the status hrefs of the resources in statusRels, keyed by their rel
+	statusLinks map[string]string
+}
+
+// ID returns the serial of the unit
+func (u *Unit) ID() string {
+	return u.id
+}
+
+// Discover reads the links of the unit root, which are followed instead of the default paths
+// from then on. Only GET links to resources of the unit itself are kept. The system and network
+// interface resources are read as well to find their status links.
+func (u *Unit) Discover(ctx context.Context) error {
+	var root models.UnitResponse
+	if err := u.client.GetJSON(ctx, unitEndpoint+u.id, &root); err != nil {
+		return err
+	}
+
+	u.links = make(map[string]string)
+	for _, link := range root.Links {
+		if link.Rel == "" || link.Rel == "self" || (link.Method != "" && link.Method != "GET") {
+			continue
+		}
+		if _, err := u.resolve(link.Href); err == nil {
+			u.links[link.Rel] = link.Href
+		}
+	}
+
+	u.statusLinks = make(map[string]string)
+	for _, rel := range statusRels {
+		href, ok := u.links[rel]
+		if !ok {
+			continue
+		}
+		var res models.UnitResponse
+		if err := u.GetJSON(ctx, href, &res); err != nil {
+			if errors.Is(err, ErrUnitOffline) {
+				return err
+			}
+			zerolog.Ctx(ctx).Debug().Err(err).Str("rel", rel).Msg("Error reading resource links, using the default status path")
+			continue
+		}
+		if status := u.statusPath(res.Links, ""); status != "" {
+			u.statusLinks[rel] = status
+		}
+	}
+	zerolog.Ctx(ctx).Debug().Int("links", len(u.links)).Msg("Discovered unit resources")
+	return nil
+}
+
+// Rels returns the rels linked from the unit root in sorted order, or nil when Discover wasn't
+// called or failed
+func (u *Unit) Rels() []string {
+	if u.links == nil {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(u.links))
+}
+
+// resolve returns the path of a unit resource relative to the base URL. path is either relative
+// to the unit, e.g. system/status, or an href of the unit as reported by the API. Dot segments
+// are resolved first, so a path can't step out of the unit with "..".
+func (u *Unit) resolve(p string) (string, error) {
+	prefix := "/" + unitEndpoint + u.id + "/"
+	if !strings.HasPrefix(p, "/") {
+		p = prefix + p
+	}
+	p, query, hasQuery := strings.Cut(p, "?")
+	p = path.Clean(p)
+	if !strings.HasPrefix(p, prefix) {
+		return "", ErrForeignPath
+	}
+	if hasQuery {
+		p += "?" + query
+	}
+	return strings.TrimPrefix(p, "/"), nil
+}
+
+// rootPath returns the href linked from the unit root as rel, or fallback when there is none
+func (u *Unit) rootPath(rel, fallback string) string {
+	if href, ok := u.links[rel]; ok {
+		return href
+	}
+	return fallback
+}
+
+// rootStatusPath returns the status href of the resource linked from the unit root as rel, or
+// fallback when either link is missing
+func (u *Unit) rootStatusPath(rel, fallback string) string {
+	if href, ok := u.statusLinks[rel]; ok {
+		return href
+	}
+	return fallback
+}
+
+// statusPath returns the href of the status link among links, or fallback when there is none
+func (u *Unit) statusPath(links []models.Link, fallback string) string {
+	for _, link := range links {
+		if link.Rel != RelStatus {
+			continue
+		}
+		if _, err := u.resolve(link.Href); err == nil {
+			return link.Href
+		}
+	}
+	return fallback
+}
+
+// Get requests a resource of the unit and returns the response body. path is either relative to
+// the unit or an href of the unit.
+func (u *Unit) Get(ctx context.Context, path string) ([]byte, error) {
+	p, err := u.resolve(path)
+	if err != nil {
+		return nil, err
+	}
+	return u.client.Get(ctx, p)
+}
+
+// GetJSON requests a resource of the unit and decodes the JSON response into v
+func (u *Unit) GetJSON(ctx context.Context, path string, v any) error {
+	p, err := u.resolve(path)
+	if err != nil {
+		return err
+	}
+	return u.client.GetJSON(ctx, p, v)
+}
+
+// GetSystemStatus follows the status link of the system resource linked from the unit root,
+// or reads system/status when Discover found none
+func (u *Unit) GetSystemStatus(ctx context.Context) (models.SystemResponse, error) {
+	var res models.SystemResponse
+	err := u.GetJSON(ctx, u.rootStatusPath(RelSystem, "system/status"), &res)
+	return res, err
+}
+
+// GetNetworkInterfacesStatus follows the status link of the network interfaces linked from the
+// unit root, or reads network_interfaces/status when Discover found none
+func (u *Unit) GetNetworkInterfacesStatus(ctx context.Context) (models.StatusResponse, error) {
+	var res models.StatusResponse
+	err := u.GetJSON(ctx, u.rootStatusPath(RelNetworkInterfaces, "network_interfaces/status"), &res)
+	return res, err
+}
+
+// ListEncoders lists the encoders of the unit with the links to their status
+func (u *Unit) ListEncoders(ctx context.Context) (models.EncodersResponse, error) {
+	var res models.EncodersResponse
+	err := u.GetJSON(ctx, u.rootPath(RelEncoders, "encoders"), &res)
+	return res, err
+}
+
+// GetEncoderStatus follows the status link of an encoder from ListEncoders. Encoders with only
+// an index set are looked up at their default path.
+func (u *Unit) GetEncoderStatus(ctx context.Context, encoder models.Encoder) (models.EncoderStatus, error) {
+	var res models.EncoderStatus
+	err := u.GetJSON(ctx, u.statusPath(encoder.Links, fmt.Sprintf("encoders/%d/status", encoder.Index)), &res)
+	return res, err
+}
+
+// ListNetworkInputs lists the network inputs of the unit with the links to their status
+func (u *Unit) ListNetworkInputs(ctx context.Context) (models.NetworkInputsResponse, error) {
+	var res models.NetworkInputsResponse
+	err := u.GetJSON(ctx, u.rootPath(RelNetworkInputs, "network_inputs"), &res)
+	return res, err
+}
+
+// GetNetworkInputStatus follows the status link of a network input from ListNetworkInputs.
+// Network inputs with only an index set are looked up at their default path.
+func (u *Unit) GetNetworkInputStatus(ctx context.Context, input models.NetworkInput) (models.NetworkInputStatus, error) {
+	var res models.NetworkInputStatus
+	err := u.GetJSON(ctx, u.statusPath(input.Links, fmt.Sprintf("network_inputs/%d/status", input.Index)), &res)
+	return res, err
+}
+
+// ListVideoOutputs lists the video outputs of the unit with the links to their status
+func (u *Unit) ListVideoOutputs(ctx context.Context) (models.VideoOutputsResponse, error) {
+	var res models.VideoOutputsResponse
+	err := u.GetJSON(ctx, u.rootPath(RelVideoOutputs, "video_outputs"), &res)
+	return res, err
+}
+
+// GetVideoOutputStatus follows the status link of a video output from ListVideoOutputs. Video
+// outputs with only an index set are looked up at their default path.
+func (u *Unit) GetVideoOutputStatus(ctx context.Context, output models.VideoOutput) (models.VideoOutputStatus, error) {
+	var res models.VideoOutputStatus
+	err := u.GetJSON(ctx, u.statusPath(output.Links, fmt.Sprintf("video_outputs/%d/status", output.Index)), &res)
+	return res, err
+}
+
+// GetThumbnail downloads a thumbnail by the href reported in a video source or program
+func (u *Unit) GetThumbnail(ctx context.Context, href string) ([]byte, error) {
+	if !strings.HasPrefix(href, "/") {
+		return nil, ErrForeignPath
+	}
+	return u.Get(ctx, href)
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Counter struct {
+	Name   string
+	Unit   string
+	Desc   string
+	Labels []string
+	// Legacy is the name exported when legacy names are enabled, without _total, see Gauge
+	Legacy string
+}
+
+// FQName returns the exported counter name, which always ends in _total
+func (c Counter) FQName(legacy bool) string {
+	return Gauge{Name: c.Name, Unit: c.Unit, Legacy: c.Legacy}.FQName(legacy) + "_total"
+}
+
+// CounterVec is a prometheus.CounterVec with the same label handling as GaugeVec
+type CounterVec struct {
+	*prometheus.CounterVec
+	labels *labeler
+}
+
+// discardCounter absorbs increments for series dropped by the limiter, it is never registered
+var discardCounter = prometheus.NewCounter(prometheus.CounterOpts{Name: "discard_total"})
+
+func (v *CounterVec) WithLabelValues(lvs ...string) prometheus.Counter {
+	lvs, ok := v.labels.values(lvs)
+	if !ok {
+		return discardCounter
+	}
+	return v.CounterVec.WithLabelValues(lvs...)
+}
+
+func NewCounterMap(metrics []Counter, opts Options) map[string]*CounterVec {
+	ret := make(map[string]*CounterVec)
+	for _, metric := range metrics {
+		name := metric.FQName(opts.LegacyNames)
+		labels, positions := opts.Labels.apply(metric.Labels)
+		ret[metric.Name] = &CounterVec{
+			CounterVec: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name:        name,
+				Help:        metric.Desc,
+				ConstLabels: opts.Labels.ExtraLabels,
+			}, labels),
+			labels: newLabeler(name, opts.Limits, positions),
+		}
+	}
+	return ret
+}
+
+// CounterValueVec exports cumulative values reported by the unit as counters. Values are set
+// rather than incremented, so a series only resets when the count on the unit does.
+type CounterValueVec struct {
+	desc   *prometheus.Desc
+	labels *labeler
+
+	mu     sync.Mutex
+	values map[string]counterValue
+}
+
+type counterValue struct {
+	lvs   []string
+	value float64
+}
+
+// Set sets the value of a series. Like a gauge the last value set is exported, it returns false
+// when the series was already set since the last Reset, e.g. because relabelling merged two
+// series, so the caller can report the clash. Negative values aren't valid counts and are dropped.
+func (v *CounterValueVec) Set(value float64, lvs ...string) bool {
+	lvs, ok := v.labels.values(lvs)
+	if !ok || value < 0 {
+		return true
+	}
+	key := labelKey(lvs)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	_, clash := v.values[key]
+	v.values[key] = counterValue{lvs: lvs, value: value}
+	return !clash
+}
+
+func (v *CounterValueVec) Reset() {
+	v.labels.reset()
+	v.mu.Lock()
+	clear(v.values)
+	v.mu.Unlock()
+}
+
+func (v *CounterValueVec) Describe(ch chan<- *prometheus.Desc) {
+	ch <- v.desc
+}
+
+func (v *CounterValueVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, c := range v.values {
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, c.value, c.lvs...)
+	}
+}
+
+func NewCounterValueMap(metrics []Counter, opts Options) map[string]*CounterValueVec {
+	ret := make(map[string]*CounterValueVec)
+	for _, metric := range metrics {
+		name := metric.FQName(opts.LegacyNames)
+		labels, positions := opts.Labels.apply(metric.Labels)
+		ret[metric.Name] = &CounterValueVec{
+			desc:   prometheus.NewDesc(name, metric.Desc, labels, opts.Labels.ExtraLabels),
+			labels: newLabeler(name, opts.Limits, positions),
+			values: make(map[string]counterValue),
+		}
+	}
+	return ret
+}
+
+// Integrator turns a rate sampled at irregular times into a counter by adding the rate
+// multiplied by the time since the previous sample of the same series
+type Integrator struct {
+	*CounterVec
+	// MaxGap is the longest interval that is integrated. Samples further apart than this,
+	// e.g. after the unit was offline, only restart the integration.
+	MaxGap time.Duration
+
+	mu   sync.Mutex
+	last map[string]observation
+}
+
+// observation is the last sample of a series, with the label values it is exported under
+type observation struct {
+	t   time.Time
+	lvs []string
+}
+
+func NewIntegratorMap(metrics []Counter, opts Options, maxGap time.Duration) map[string]*Integrator {
+	ret := make(map[string]*Integrator)
+	for name, counter := range NewCounterMap(metrics, opts) {
+		ret[name] = &Integrator{
+			CounterVec: counter,
+			MaxGap:     maxGap,
+			last:       make(map[string]observation),
+		}
+	}
+	return ret
+}
+
+// Observe records the per-second rate of a series at time t
+func (i *Integrator) Observe(t time.Time, rate float64, lvs ...string) {
+	key := labelKey(lvs)
+	exported, ok := i.labels.values(slices.Clone(lvs))
+	if !ok {
+		return
+	}
+	counter := i.CounterVec.CounterVec.WithLabelValues(exported...)
+
+	i.mu.Lock()
+	last, ok := i.last[key]
+	// Samples older than the last one are ignored, so no interval is integrated twice
+	if ok && t.Before(last.t) {
+		i.mu.Unlock()
+		return
+	}
+	i.last[key] = observation{t: t, lvs: exported}
+	i.mu.Unlock()
+
+	elapsed := t.Sub(last.t)
+	if !ok || elapsed <= 0 || elapsed > i.MaxGap || rate <= 0 {
+		return
+	}
+	counter.Add(rate * elapsed.Seconds())
+}
+
+// Prune forgets the series that weren't observed since t, e.g. destinations removed from the
+// unit, and stops exporting their counters
+func (i *Integrator) Prune(t time.Time) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for key, lvs := range pruneObservations(i.last, t) {
+		i.CounterVec.CounterVec.DeleteLabelValues(lvs...)
+		i.labels.forget(key)
+	}
+}
+
+// pruneObservations removes the sources not observed since t and returns the exported series
+// left without a source, keyed by their label key. Series merged by relabelling are only
+// returned once none of their sources is observed.
+func pruneObservations(last map[string]observation, t time.Time) map[string][]string {
+	stale := make(map[string][]string)
+	for key, o := range last {
+		if o.t.Before(t) {
+			delete(last, key)
+			stale[labelKey(o.lvs)] = o.lvs
+		}
+	}
+	for _, o := range last {
+		delete(stale, labelKey(o.lvs))
+	}
+	return stale
+}
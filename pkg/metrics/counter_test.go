@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIntegratorObserve(t *testing.T) {
+	i := NewIntegratorMap([]Counter{{Name: "test_integrated", Labels: []string{"path"}}}, Options{}, time.Minute)["test_integrated"]
+	t0 := time.Unix(1700000000, 0)
+
+	// The first sample only starts the integration
+	i.Observe(t0, 100, "eth0")
+	i.Observe(t0.Add(10*time.Second), 100, "eth0")
+	i.Observe(t0.Add(20*time.Second), 50, "eth0")
+	// Zero and negative rates add nothing but move the integration on
+	i.Observe(t0.Add(30*time.Second), -10, "eth0")
+	i.Observe(t0.Add(40*time.Second), 0, "eth0")
+	// Samples out of order are ignored
+	i.Observe(t0.Add(35*time.Second), 100, "eth0")
+	i.Observe(t0.Add(50*time.Second), 10, "eth0")
+	// Gaps longer than MaxGap, e.g. while the unit was offline, restart the integration
+	i.Observe(t0.Add(5*time.Minute), 100, "eth0")
+	i.Observe(t0.Add(5*time.Minute+time.Second), 100, "eth0")
+
+	got := collect(t, i)
+	if v := got["path=eth0"]; math.Abs(v-(1000+500+100+100)) > 1e-9 {
+		t.Errorf("integrated %v, want 1700", v)
+	}
+}
+
+func TestIntegratorPrune(t *testing.T) {
+	i := NewIntegratorMap([]Counter{{Name: "test_pruned", Labels: []string{"destination", "path"}}},
+		Options{Limits: Limits{MaxSeries: 2}, Labels: LabelConfig{Drop: []string{"path"}}}, time.Minute)["test_pruned"]
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Second)
+	t2 := t1.Add(time.Second)
+
+	// Both paths of destination 0 are exported as one series after relabelling
+	for _, t := range []time.Time{t0, t1} {
+		i.Observe(t, 1, "0", "eth0")
+		i.Observe(t, 1, "0", "eth1")
+		i.Observe(t, 1, "1", "eth0")
+	}
+	want := map[string]float64{"destination=0": 2, "destination=1": 1}
+	if got := collect(t, i); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// Destination 0 is still exported while one of its paths is observed, destination 1 is gone
+	i.Observe(t2, 1, "0", "eth1")
+	i.Prune(t2)
+	want = map[string]float64{"destination=0": 3}
+	if got := collect(t, i); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after prune got %v, want %v", got, want)
+	}
+
+	// The pruned series no longer counts towards MaxSeries
+	i.Observe(t2, 1, "2", "eth0")
+	i.Observe(t2.Add(time.Second), 1, "2", "eth0")
+	want = map[string]float64{"destination=0": 3, "destination=2": 1}
+	if got := collect(t, i); !reflect.DeepEqual(got, want) {
+		t.Errorf("after new destination got %v, want %v", got, want)
+	}
+}
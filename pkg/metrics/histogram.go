@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type Histogram struct {
+	Name   string
+	Unit   string
+	Desc   string
+	Labels []string
+	// Buckets are the classic buckets exposed to scrapers without native histogram support
+	Buckets []float64
+}
+
+// HistogramVec is a prometheus.HistogramVec with the same label handling as GaugeVec. It
+// accumulates across polls, so like Integrator it tracks when each series was last observed
+// and series that are no longer observed can be pruned.
+type HistogramVec struct {
+	*prometheus.HistogramVec
+	labels *labeler
+
+	mu   sync.Mutex
+	last map[string]observation
+}
+
+// Observe adds a sample taken at time t to a series
+func (v *HistogramVec) Observe(t time.Time, value float64, lvs ...string) {
+	key := labelKey(lvs)
+	exported, ok := v.labels.values(slices.Clone(lvs))
+	if !ok {
+		return
+	}
+
+	v.mu.Lock()
+	if last, ok := v.last[key]; !ok || !t.Before(last.t) {
+		v.last[key] = observation{t: t, lvs: exported}
+	}
+	v.mu.Unlock()
+	v.HistogramVec.WithLabelValues(exported...).Observe(value)
+}
+
+// Prune forgets the series that weren't observed since t, e.g. bonding paths removed from the
+// unit or encoders that were renamed, and stops exporting them
+func (v *HistogramVec) Prune(t time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for key, lvs := range pruneObservations(v.last, t) {
+		v.HistogramVec.DeleteLabelValues(lvs...)
+		v.labels.forget(key)
+	}
+}
+
+// NewHistogramMap builds histograms that are exposed as native histograms with a classic
+// bucket fallback
+func NewHistogramMap(metrics []Histogram, opts Options) map[string]*HistogramVec {
+	ret := make(map[string]*HistogramVec)
+	for _, metric := range metrics {
+		name := Gauge{Name: metric.Name, Unit: metric.Unit}.FQName(opts.LegacyNames)
+		labels, positions := opts.Labels.apply(metric.Labels)
+		ret[metric.Name] = &HistogramVec{
+			HistogramVec: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:                            name,
+				Help:                            metric.Desc,
+				ConstLabels:                     opts.Labels.ExtraLabels,
+				Buckets:                         metric.Buckets,
+				NativeHistogramBucketFactor:     1.1,
+				NativeHistogramMaxBucketNumber:  100,
+				NativeHistogramMinResetDuration: time.Hour,
+			}, labels),
+			labels: newLabeler(name, opts.Limits, positions),
+			last:   make(map[string]observation),
+		}
+	}
+	return ret
+}
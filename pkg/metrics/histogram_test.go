@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHistogramPrune(t *testing.T) {
+	h := NewHistogramMap([]Histogram{{Name: "test_latency", Unit: UnitSeconds, Labels: []string{"encoder", "path"}, Buckets: []float64{0.1, 1}}},
+		Options{Limits: Limits{MaxSeries: 2}})["test_latency"]
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Minute)
+
+	h.Observe(t0, 0.05, "Enc A", "eth0")
+	h.Observe(t0, 0.2, "Enc A", "eth1")
+	h.Observe(t0, 0.3, "Enc A", "eth2")
+	want := map[string]float64{"encoder=Enc A,path=eth0": 1, "encoder=Enc A,path=eth1": 1}
+	if got := collect(t, h); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+
+	// eth1 disappears and the encoder is renamed, only the series of the current poll are kept
+	h.Observe(t1, 0.05, "Enc A", "eth0")
+	h.Prune(t1)
+	want = map[string]float64{"encoder=Enc A,path=eth0": 2}
+	if got := collect(t, h); !reflect.DeepEqual(got, want) {
+		t.Fatalf("after prune got %v, want %v", got, want)
+	}
+
+	// Pruned series free their place in the series limit
+	h.Observe(t1, 0.4, "Enc B", "eth0")
+	want = map[string]float64{"encoder=Enc A,path=eth0": 2, "encoder=Enc B,path=eth0": 1}
+	if got := collect(t, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("after rename got %v, want %v", got, want)
+	}
+}
+
+func TestHistogramPruneMergedSeries(t *testing.T) {
+	h := NewHistogramMap([]Histogram{{Name: "test_loss", Labels: []string{"encoder", "path"}}},
+		Options{Labels: LabelConfig{Drop: []string{"path"}}})["test_loss"]
+	t0 := time.Unix(1700000000, 0)
+	t1 := t0.Add(time.Minute)
+
+	h.Observe(t0, 0, "Enc A", "eth0")
+	h.Observe(t0, 0, "Enc A", "eth1")
+	// The series stays while one of the paths merged into it is still observed
+	h.Observe(t1, 0, "Enc A", "eth1")
+	h.Prune(t1)
+	want := map[string]float64{"encoder=Enc A": 3}
+	if got := collect(t, h); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	h.Prune(t1.Add(time.Minute))
+	if got := collect(t, h); len(got) != 0 {
+		t.Errorf("after all paths disappeared got %v", got)
+	}
+}
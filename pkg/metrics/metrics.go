@@ -1,28 +1,244 @@
 package metrics
 
 import (
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// Namespace prefixes every exported metric name
+const Namespace = "direkt"
+
+// Base units appended to metric names
+const (
+	UnitSeconds        = "seconds"
+	UnitBytes          = "bytes"
+	UnitBitsPerSecond  = "bits_per_second"
+	UnitBytesPerSecond = "bytes_per_second"
+	UnitRatio          = "ratio"
+	UnitPixels         = "pixels"
+)
+
 type Gauge struct {
 	Name   string
+	Unit   string
 	Desc   string
 	Labels []string
+	// Legacy is the name the metric was exported under before namespacing. Only needed
+	// when it differs from Name with the unit appended.
+	Legacy string
+	// LegacyOnly marks metrics that have been superseded and are only exported when legacy
+	// names are enabled
+	LegacyOnly bool
+}
+
+// FQName returns the exported metric name, which is namespaced and suffixed with the unit
+// unless legacy names are requested
+func (g Gauge) FQName(legacy bool) string {
+	name := g.Name
+	if g.Unit != "" {
+		name += "_" + g.Unit
+	}
+	if legacy {
+		if g.Legacy != "" {
+			return g.Legacy
+		}
+		return name
+	}
+	return prometheus.BuildFQName(Namespace, "", name)
+}
+
+// DroppedSeries counts series that were not exported because a metric hit its series limit
+var DroppedSeries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: prometheus.BuildFQName(Namespace, "exporter", "dropped_series_total"),
+	Help: "Number of series dropped because the metric exceeded its maximum number of series",
+}, []string{"metric"})
+
+// Limits bounds the cardinality a single metric can produce from device supplied label values
+type Limits struct {
+	// MaxSeries is the maximum number of series per metric, 0 disables the limit
+	MaxSeries int
+	// MaxLabelLength is the maximum length of a label value in characters, 0 disables truncation
+	MaxLabelLength int
+}
+
+// LabelConfig rewrites the labels of a metric family before it is registered
+type LabelConfig struct {
+	// Keep lists the labels to export, all labels are kept when empty
+	Keep []string `yaml:"keep"`
+	// Drop lists labels to remove
+	Drop []string `yaml:"drop"`
+	// Rename maps label names to the names they are exported under
+	Rename map[string]string `yaml:"rename"`
+	// ExtraLabels are static labels added to every metric in the family
+	ExtraLabels map[string]string `yaml:"extra_labels"`
+}
+
+// apply returns the exported label names and the positions of the original labels they are
+// taken from, or nil positions when all labels are kept in order
+func (c LabelConfig) apply(labels []string) ([]string, []int) {
+	if len(c.Keep) == 0 && len(c.Drop) == 0 && len(c.Rename) == 0 {
+		return labels, nil
+	}
+
+	names := make([]string, 0, len(labels))
+	positions := make([]int, 0, len(labels))
+	for i, label := range labels {
+		if len(c.Keep) > 0 && !slices.Contains(c.Keep, label) {
+			continue
+		}
+		if slices.Contains(c.Drop, label) {
+			continue
+		}
+		if renamed, ok := c.Rename[label]; ok {
+			label = renamed
+		}
+		names = append(names, label)
+		positions = append(positions, i)
+	}
+	return names, positions
+}
+
+// Options controls how the metrics of a family are built
+type Options struct {
+	LegacyNames bool
+	Limits      Limits
+	Labels      LabelConfig
+}
+
+// labeler maps label values onto the labels left after relabelling, sanitises them and
+// drops series beyond the limits of a metric
+type labeler struct {
+	name      string
+	limits    Limits
+	positions []int
+
+	mu     sync.Mutex
+	series map[string]struct{}
+}
+
+func newLabeler(name string, limits Limits, positions []int) *labeler {
+	return &labeler{
+		name:      name,
+		limits:    limits,
+		positions: positions,
+		series:    make(map[string]struct{}),
+	}
+}
+
+// values returns the label values to export, or false if the series has to be dropped
+func (l *labeler) values(lvs []string) ([]string, bool) {
+	if l.positions != nil {
+		kept := make([]string, 0, len(l.positions))
+		for _, i := range l.positions {
+			if i < len(lvs) {
+				kept = append(kept, lvs[i])
+			}
+		}
+		lvs = kept
+	}
+	for i, lv := range lvs {
+		lvs[i] = SanitiseLabelValue(lv, l.limits.MaxLabelLength)
+	}
+
+	if l.limits.MaxSeries > 0 {
+		key := labelKey(lvs)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.series[key]; !ok {
+			if len(l.series) >= l.limits.MaxSeries {
+				DroppedSeries.WithLabelValues(l.name).Inc()
+				return nil, false
+			}
+			l.series[key] = struct{}{}
+		}
+	}
+	return lvs, true
+}
+
+// forget removes a series from the limit, so it no longer counts towards MaxSeries
+func (l *labeler) forget(key string) {
+	l.mu.Lock()
+	delete(l.series, key)
+	l.mu.Unlock()
+}
+
+func (l *labeler) reset() {
+	l.mu.Lock()
+	clear(l.series)
+	l.mu.Unlock()
+}
+
+// GaugeVec is a prometheus.GaugeVec that sanitises label values, drops series beyond its limits
+// and maps label values onto the labels left after relabelling
+type GaugeVec struct {
+	*prometheus.GaugeVec
+	labels *labeler
+}
+
+// discard absorbs values for series dropped by the limiter, it is never registered
+var discard = prometheus.NewGauge(prometheus.GaugeOpts{Name: "discard"})
+
+func (v *GaugeVec) WithLabelValues(lvs ...string) prometheus.Gauge {
+	lvs, ok := v.labels.values(lvs)
+	if !ok {
+		return discard
+	}
+	return v.GaugeVec.WithLabelValues(lvs...)
+}
+
+func (v *GaugeVec) Reset() {
+	v.labels.reset()
+	v.GaugeVec.Reset()
 }
 
-func NewGaugeMap(metrics []Gauge) map[string]*prometheus.GaugeVec {
-	ret := make(map[string]*prometheus.GaugeVec)
+func NewGaugeMap(metrics []Gauge, opts Options) map[string]*GaugeVec {
+	ret := make(map[string]*GaugeVec)
 	for _, metric := range metrics {
-		ret[metric.Name] = prometheus.NewGaugeVec(prometheus.GaugeOpts{
-			Name: metric.Name,
-			Help: metric.Desc,
-		}, metric.Labels)
+		if metric.LegacyOnly && !opts.LegacyNames {
+			continue
+		}
+		name := metric.FQName(opts.LegacyNames)
+		labels, positions := opts.Labels.apply(metric.Labels)
+		ret[metric.Name] = &GaugeVec{
+			GaugeVec: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name:        name,
+				Help:        metric.Desc,
+				ConstLabels: opts.Labels.ExtraLabels,
+			}, labels),
+			labels: newLabeler(name, opts.Limits, positions),
+		}
 	}
 	return ret
 }
 
+// labelKey joins label values into a key identifying a series
+func labelKey(lvs []string) string {
+	return strings.Join(lvs, "\xff")
+}
+
+// SanitiseLabelValue replaces invalid UTF-8 and control characters, truncates the value to
+// maxLen characters when maxLen is positive and trims surrounding whitespace
+func SanitiseLabelValue(s string, maxLen int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+	if maxLen > 0 {
+		if r := []rune(s); len(r) > maxLen {
+			s = string(r[:maxLen])
+		}
+	}
+	return strings.TrimSpace(s)
+}
+
 func StringBoolToInt(s string) int {
 	if s == "ok" {
 		s = "true"
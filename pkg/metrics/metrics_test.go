@@ -0,0 +1,255 @@
+package metrics
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// collect returns the value of every series of a collector keyed by its label pairs, e.g.
+// "a=1,b=2", in the order of the label names
+func collect(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+	ch := make(chan prometheus.Metric, 1000)
+	c.Collect(ch)
+	close(ch)
+
+	values := make(map[string]float64)
+	for m := range ch {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+		pairs := make([]string, 0, len(pb.GetLabel()))
+		for _, l := range pb.GetLabel() {
+			pairs = append(pairs, l.GetName()+"="+l.GetValue())
+		}
+		var v float64
+		switch {
+		case pb.Gauge != nil:
+			v = pb.GetGauge().GetValue()
+		case pb.Counter != nil:
+			v = pb.GetCounter().GetValue()
+		case pb.Histogram != nil:
+			v = float64(pb.GetHistogram().GetSampleCount())
+		}
+		values[strings.Join(pairs, ",")] = v
+	}
+	return values
+}
+
+func droppedSeries(t *testing.T, name string) float64 {
+	t.Helper()
+	var pb dto.Metric
+	if err := DroppedSeries.WithLabelValues(name).Write(&pb); err != nil {
+		t.Fatal(err)
+	}
+	return pb.GetCounter().GetValue()
+}
+
+func TestSanitiseLabelValue(t *testing.T) {
+	tests := []struct {
+		in     string
+		maxLen int
+		want   string
+	}{
+		{"Encoder 1", 0, "Encoder 1"},
+		{"  padded\t", 0, "padded"},
+		{"line\nbreak", 0, "line break"},
+		{"bell\a", 0, "bell"},
+		{"bad \xff byte", 0, "bad � byte"},
+		{"truncated", 5, "trunc"},
+		{"åäö-ünïcode", 3, "åäö"},
+		{"short", 10, "short"},
+		{"trailing space cut ", 15, "trailing space"},
+	}
+	for _, tt := range tests {
+		if got := SanitiseLabelValue(tt.in, tt.maxLen); got != tt.want {
+			t.Errorf("SanitiseLabelValue(%q, %d) = %q, want %q", tt.in, tt.maxLen, got, tt.want)
+		}
+	}
+}
+
+func TestLabelConfigApply(t *testing.T) {
+	labels := []string{"index", "name", "address"}
+	tests := []struct {
+		config    LabelConfig
+		names     []string
+		positions []int
+	}{
+		{LabelConfig{}, labels, nil},
+		{LabelConfig{ExtraLabels: map[string]string{"site": "ldn"}}, labels, nil},
+		{LabelConfig{Keep: []string{"index", "address"}}, []string{"index", "address"}, []int{0, 2}},
+		{LabelConfig{Drop: []string{"name"}}, []string{"index", "address"}, []int{0, 2}},
+		{LabelConfig{Rename: map[string]string{"address": "ip"}}, []string{"index", "name", "ip"}, []int{0, 1, 2}},
+		{LabelConfig{Keep: []string{"index", "name"}, Drop: []string{"name"}}, []string{"index"}, []int{0}},
+		{LabelConfig{Keep: []string{"other"}}, []string{}, []int{}},
+	}
+	for _, tt := range tests {
+		names, positions := tt.config.apply(labels)
+		if !reflect.DeepEqual(names, tt.names) || !reflect.DeepEqual(positions, tt.positions) {
+			t.Errorf("%+v.apply() = %v, %v, want %v, %v", tt.config, names, positions, tt.names, tt.positions)
+		}
+	}
+}
+
+func TestGaugeLabelValues(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   Options
+		series [][]string
+		want   map[string]float64
+	}{
+		{
+			name:   "all labels",
+			series: [][]string{{"0", "Enc A"}, {"1", "Enc B"}},
+			want:   map[string]float64{"index=0,name=Enc A": 1, "index=1,name=Enc B": 2},
+		},
+		{
+			name:   "drop",
+			opts:   Options{Labels: LabelConfig{Drop: []string{"index"}}},
+			series: [][]string{{"0", "Enc A"}, {"1", "Enc B"}},
+			want:   map[string]float64{"name=Enc A": 1, "name=Enc B": 2},
+		},
+		{
+			name:   "keep and rename",
+			opts:   Options{Labels: LabelConfig{Keep: []string{"name"}, Rename: map[string]string{"name": "encoder"}}},
+			series: [][]string{{"0", "Enc A"}},
+			want:   map[string]float64{"encoder=Enc A": 1},
+		},
+		{
+			// Dropping the label that distinguishes two series leaves the last one
+			name:   "clash after relabelling",
+			opts:   Options{Labels: LabelConfig{Drop: []string{"index"}}},
+			series: [][]string{{"0", "Enc"}, {"1", "Enc"}},
+			want:   map[string]float64{"name=Enc": 2},
+		},
+		{
+			name:   "max label length",
+			opts:   Options{Limits: Limits{MaxLabelLength: 3}},
+			series: [][]string{{"0", "Encoder\n"}},
+			want:   map[string]float64{"index=0,name=Enc": 1},
+		},
+		{
+			name:   "max series",
+			opts:   Options{Limits: Limits{MaxSeries: 2}},
+			series: [][]string{{"0", "a"}, {"1", "b"}, {"2", "c"}, {"0", "a"}},
+			want:   map[string]float64{"index=0,name=a": 4, "index=1,name=b": 2},
+		},
+		{
+			// Series merged by relabelling only count once towards the limit
+			name:   "max series after relabelling",
+			opts:   Options{Limits: Limits{MaxSeries: 1}, Labels: LabelConfig{Drop: []string{"index"}}},
+			series: [][]string{{"0", "a"}, {"1", "a"}, {"2", "b"}},
+			want:   map[string]float64{"name=a": 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "test_" + strings.ReplaceAll(tt.name, " ", "_")
+			vec := NewGaugeMap([]Gauge{{Name: name, Labels: []string{"index", "name"}}}, tt.opts)[name]
+			for i, lvs := range tt.series {
+				vec.WithLabelValues(lvs...).Set(float64(i + 1))
+			}
+			if got := collect(t, vec); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMaxSeriesCountsDroppedSeries(t *testing.T) {
+	g := NewGaugeMap([]Gauge{{Name: "test_dropped", Labels: []string{"index"}}}, Options{Limits: Limits{MaxSeries: 1}})["test_dropped"]
+	name := Gauge{Name: "test_dropped"}.FQName(false)
+	before := droppedSeries(t, name)
+
+	g.WithLabelValues("0").Set(1)
+	g.WithLabelValues("1").Set(1)
+	g.WithLabelValues("2").Set(1)
+	if got := droppedSeries(t, name) - before; got != 2 {
+		t.Errorf("counted %v dropped series, want 2", got)
+	}
+
+	// Reset frees the limit for the series of the next probe
+	g.Reset()
+	g.WithLabelValues("1").Set(1)
+	if got := collect(t, g); !reflect.DeepEqual(got, map[string]float64{"index=1": 1}) {
+		t.Errorf("after reset got %v", got)
+	}
+}
+
+func TestStateSetKeepsStateLabel(t *testing.T) {
+	sets := NewStateSetMap([]StateSet{{Name: "test_state", Labels: []string{"index", "name"}, States: []string{"ok", "failed"}}},
+		Options{Labels: LabelConfig{Keep: []string{"index"}}})
+	sets["test_state"].Set("ok", "0", "Enc A")
+
+	want := map[string]float64{"index=0,state=ok": 1, "index=0,state=failed": 0}
+	if got := collect(t, sets["test_state"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestGaugeFQName(t *testing.T) {
+	tests := []struct {
+		gauge  Gauge
+		legacy bool
+		want   string
+	}{
+		{Gauge{Name: "cpu"}, false, "direkt_cpu"},
+		{Gauge{Name: "memory", Unit: UnitBytes}, false, "direkt_memory_bytes"},
+		{Gauge{Name: "memory", Unit: UnitBytes}, true, "memory_bytes"},
+		{Gauge{Name: "cpu", Unit: UnitRatio, Legacy: "cpu_percent"}, true, "cpu_percent"},
+		{Gauge{Name: "cpu", Unit: UnitRatio, Legacy: "cpu_percent"}, false, "direkt_cpu_ratio"},
+	}
+	for _, tt := range tests {
+		if got := tt.gauge.FQName(tt.legacy); got != tt.want {
+			t.Errorf("%+v.FQName(%v) = %q, want %q", tt.gauge, tt.legacy, got, tt.want)
+		}
+	}
+	if got := (Counter{Name: "sent", Unit: UnitBytes}).FQName(false); got != "direkt_sent_bytes_total" {
+		t.Errorf("counter name = %q, want direkt_sent_bytes_total", got)
+	}
+}
+
+func TestStateSetIgnoresDroppedState(t *testing.T) {
+	sets := NewStateSetMap([]StateSet{{Name: "test_state_drop", Labels: []string{"index"}, States: []string{"ok", "failed"}}},
+		Options{Labels: LabelConfig{Drop: []string{"index", LabelState}}})
+	sets["test_state_drop"].Set("failed", "0")
+
+	want := map[string]float64{"state=ok": 0, "state=failed": 1}
+	if got := collect(t, sets["test_state_drop"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCounterValueVecClash(t *testing.T) {
+	vec := NewCounterValueMap([]Counter{{Name: "test_reported", Labels: []string{"index", "name"}}},
+		Options{Labels: LabelConfig{Drop: []string{"index"}}})["test_reported"]
+
+	if !vec.Set(3, "0", "Enc") {
+		t.Error("first series reported as a clash")
+	}
+	// Both series are exported as name=Enc after relabelling, the last one wins like for gauges
+	if vec.Set(5, "1", "Enc") {
+		t.Error("clash after relabelling not reported")
+	}
+	if !vec.Set(-1, "2", "Other") {
+		t.Error("negative value reported as a clash")
+	}
+	want := map[string]float64{"name=Enc": 5}
+	if got := collect(t, vec); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	vec.Reset()
+	if !vec.Set(7, "0", "Enc") {
+		t.Error("series set after Reset reported as a clash")
+	}
+	want = map[string]float64{"name=Enc": 7}
+	if got := collect(t, vec); !reflect.DeepEqual(got, want) {
+		t.Errorf("after reset got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import "slices"
+
+// LabelState is the label holding the state name of a state set
+const LabelState = "state"
+
+// StateSet is an enum-like metric exported as one series per state, the current state is 1
+// and all other known states are 0
+type StateSet struct {
+	Name   string
+	Desc   string
+	Labels []string
+	// States are the values the API is known to return. Other values are exported as they
+	// are seen.
+	States []string
+	// Legacy is the name exported when legacy names are enabled, see Gauge
+	Legacy string
+}
+
+// StateSetVec is a GaugeVec with an additional state label
+type StateSetVec struct {
+	*GaugeVec
+	states []string
+}
+
+// Set marks state as the current state of the series identified by lvs. An empty state marks
+// all known states as inactive.
+func (v *StateSetVec) Set(state string, lvs ...string) {
+	for _, s := range v.states {
+		v.GaugeVec.WithLabelValues(append(slices.Clone(lvs), s)...).Set(BoolToFloat64(s == state))
+	}
+	if state != "" && !slices.Contains(v.states, state) {
+		v.GaugeVec.WithLabelValues(append(slices.Clone(lvs), state)...).Set(1)
+	}
+}
+
+func NewStateSetMap(metrics []StateSet, opts Options) map[string]*StateSetVec {
+	gauges := make([]Gauge, 0, len(metrics))
+	for _, metric := range metrics {
+		gauges = append(gauges, Gauge{
+			Name:   metric.Name,
+			Desc:   metric.Desc,
+			Labels: append(slices.Clone(metric.Labels), LabelState),
+			Legacy: metric.Legacy,
+		})
+	}
+	// The state label can't be dropped by relabelling, which would collapse all states onto one
+	// series
+	if len(opts.Labels.Keep) > 0 {
+		opts.Labels.Keep = append(slices.Clone(opts.Labels.Keep), LabelState)
+	}
+	if slices.Contains(opts.Labels.Drop, LabelState) {
+		opts.Labels.Drop = slices.DeleteFunc(slices.Clone(opts.Labels.Drop), func(label string) bool {
+			return label == LabelState
+		})
+	}
+	gaugeMap := NewGaugeMap(gauges, opts)
+
+	ret := make(map[string]*StateSetVec)
+	for _, metric := range metrics {
+		ret[metric.Name] = &StateSetVec{
+			GaugeVec: gaugeMap[metric.Name],
+			states:   metric.States,
+		}
+	}
+	return ret
+}
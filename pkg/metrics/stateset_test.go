@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStateSet(t *testing.T) {
+	sets := NewStateSetMap([]StateSet{{Name: "test_health", Labels: []string{"path"}, States: []string{"ok", "degraded"}}}, Options{})
+	set := sets["test_health"]
+
+	tests := []struct {
+		state string
+		want  map[string]float64
+	}{
+		{"ok", map[string]float64{"path=eth0,state=ok": 1, "path=eth0,state=degraded": 0}},
+		{"degraded", map[string]float64{"path=eth0,state=ok": 0, "path=eth0,state=degraded": 1}},
+		// States the exporter doesn't know are added as they are seen
+		{"lost", map[string]float64{"path=eth0,state=ok": 0, "path=eth0,state=degraded": 0, "path=eth0,state=lost": 1}},
+		// An empty state marks all known states as inactive
+		{"", map[string]float64{"path=eth0,state=ok": 0, "path=eth0,state=degraded": 0}},
+	}
+	for _, tt := range tests {
+		set.Reset()
+		set.Set(tt.state, "eth0")
+		if got := collect(t, set); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Set(%q) exported %v, want %v", tt.state, got, tt.want)
+		}
+	}
+}
+
+func TestStateSetLegacyName(t *testing.T) {
+	defs := []StateSet{{Name: "test_legacy", Legacy: "test_legacy_state", Labels: []string{}, States: []string{"ok"}}}
+	for legacy, want := range map[bool]string{false: "direkt_test_legacy", true: "test_legacy_state"} {
+		registry := prometheus.NewRegistry()
+		set := NewStateSetMap(defs, Options{LegacyNames: legacy})["test_legacy"]
+		registry.MustRegister(set)
+		set.Set("ok")
+		mfs, err := registry.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mfs) != 1 || mfs[0].GetName() != want {
+			t.Errorf("legacy %v: got %v, want %s", legacy, mfs, want)
+		}
+	}
+}
@@ -35,6 +35,7 @@ type DecoderAudioFormat struct {
 type DecoderAudioCodec struct {
 	Name            string `json:"name"`
 	AdaptiveBitrate bool   `json:"adaptive_bitrate"`
+	Bitrate         int    `json:"bitrate"`
 }
 
 type Audio struct {
@@ -65,8 +66,12 @@ type Program struct {
 }
 
 type DecoderBondingPath struct {
-	Address  string   `json:"address"`
-	Messages []string `json:"messages"`
+	Address    string   `json:"address"`
+	Messages   []string `json:"messages"`
+	Active     bool     `json:"active"`
+	Bitrate    float64  `json:"bitrate"`
+	PacketLoss float64  `json:"packet_loss"`
+	Latency    float64  `json:"latency"`
 }
 
 type DecoderBonding struct {
@@ -105,7 +110,7 @@ type DecoderDestinations struct {
 	Basic        []string            `json:"basic"`
 	TCPOnRequest DestinationsClients `json:"tcp_on_request"`
 	SRTOnRequest DestinationsClients `json:"srt_on_request"`
-	RTMP         []string            `json:"rtmp"`
+	RTMP         []RTMPDestination   `json:"rtmp"`
 }
 
 type NetworkInputStatus struct {
@@ -5,3 +5,7 @@ type Link struct {
 	Method string `json:"method"`
 	Rel    string `json:"rel"`
 }
+
+type UnitResponse struct {
+	Links []Link `json:"_links"`
+}
@@ -12,10 +12,10 @@ type EncoderStatus struct {
 }
 
 type EncoderDestinations struct {
-	TCPOnRequest TCPOnRequest  `json:"tcp_on_request"`
-	SRTOnRequest SRTOnRequest  `json:"srt_on_request"`
-	RTMP         []any         `json:"rtmp"`
-	Basic        []BasicOutput `json:"basic"`
+	TCPOnRequest TCPOnRequest      `json:"tcp_on_request"`
+	SRTOnRequest SRTOnRequest      `json:"srt_on_request"`
+	RTMP         []RTMPDestination `json:"rtmp"`
+	Basic        []BasicOutput     `json:"basic"`
 }
 
 type TCPOnRequest struct {
@@ -73,3 +73,11 @@ type EncodingStatus struct {
 	TotalBitrate float64       `json:"total_bitrate"`
 	Video        VideoStream   `json:"video"`
 }
+
+type RTMPDestination struct {
+	URL        string  `json:"url"`
+	Connected  bool    `json:"connected"`
+	Bitrate    float64 `json:"bitrate"`
+	Reconnects int     `json:"reconnects"`
+	Messages   []any   `json:"messages"`
+}